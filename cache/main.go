@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// --- Cache ---
+/*
+
+	Every send looks up the customer, its biller and its plan. Those
+	lookups are the same for thousands of messages, so we keep the results
+	in memory:
+
+	- The cache holds at most `capacity` keys, when it is full the Policy
+	(LRU, LFU or TTL, see policy.go) picks the key to evict.
+	- GetOrLoad calls the loader on a miss. When many goroutines ask for
+	the same missing key at the same time, only ONE of them runs the
+	loader and the others wait for its result (like singleflight).
+	- Stats reports hits, misses, loads and evictions.
+
+	A Cache is safe for concurrent use.
+*/
+
+var (
+	ErrInvalidCapacity = errors.New("cache capacity must be greater than zero")
+	ErrNilPolicy       = errors.New("cache needs an eviction policy")
+	// ErrLoadPanicked is returned to the callers that waited for a load that panicked.
+	ErrLoadPanicked = errors.New("cache load panicked")
+)
+
+type Stats struct {
+	Hits       int
+	Misses     int
+	Loads      int
+	LoadErrors int
+	Evictions  int
+}
+
+// HitRate returns the fraction of reads served from the cache.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// call is a load in progress, the goroutines that wait for it block on done.
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type Cache[K comparable, V any] struct {
+	mu       *sync.Mutex
+	capacity int
+	policy   Policy[K]
+	values   map[K]V
+	loading  map[K]*call[V]
+	stats    Stats
+	now      func() time.Time
+}
+
+func New[K comparable, V any](capacity int, policy Policy[K]) (*Cache[K, V], error) {
+	if capacity <= 0 {
+		return nil, ErrInvalidCapacity
+	}
+	if policy == nil {
+		return nil, ErrNilPolicy
+	}
+	return &Cache[K, V]{
+		mu:       &sync.Mutex{},
+		capacity: capacity,
+		policy:   policy,
+		values:   map[K]V{},
+		loading:  map[K]*call[V]{},
+		now:      time.Now,
+	}, nil
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.lookup(key)
+	if ok {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	return value, ok
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value)
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delete(key)
+}
+
+// Len returns the number of keys, expired keys that were not read yet included.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.values)
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// GetOrLoad returns the cached value of key or loads it with load.
+// Concurrent calls for the same key share a single call to load.
+// Errors are returned to every waiting caller and are not cached.
+// When load panics the panic goes on in the caller that ran it and the
+// waiting callers get ErrLoadPanicked, like singleflight does.
+func (c *Cache[K, V]) GetOrLoad(key K, load func(K) (V, error)) (V, error) {
+	c.mu.Lock()
+	if value, ok := c.lookup(key); ok {
+		c.stats.Hits++
+		c.mu.Unlock()
+		return value, nil
+	}
+	c.stats.Misses++
+	if inFlight, ok := c.loading[key]; ok {
+		c.mu.Unlock()
+		<-inFlight.done
+		return inFlight.value, inFlight.err
+	}
+	current := &call[V]{done: make(chan struct{})}
+	c.loading[key] = current
+	c.mu.Unlock()
+
+	// the deferred cleanup also runs when load panics, otherwise the key
+	// would stay loading and every later call for it would block forever
+	finished := false
+	defer func() {
+		c.mu.Lock()
+		delete(c.loading, key)
+		c.stats.Loads++
+		switch {
+		case !finished:
+			current.err = ErrLoadPanicked
+			c.stats.LoadErrors++
+		case current.err != nil:
+			c.stats.LoadErrors++
+		default:
+			c.set(key, current.value)
+		}
+		c.mu.Unlock()
+		close(current.done)
+	}()
+	current.value, current.err = load(key)
+	finished = true
+	return current.value, current.err
+}
+
+// lookup must be called with the mutex locked, it drops the key when it expired.
+func (c *Cache[K, V]) lookup(key K) (V, bool) {
+	value, ok := c.values[key]
+	if !ok {
+		return value, false
+	}
+	now := c.now()
+	if c.policy.Expired(key, now) {
+		c.delete(key)
+		var zero V
+		return zero, false
+	}
+	c.policy.Touch(key, now)
+	return value, true
+}
+
+// set must be called with the mutex locked.
+func (c *Cache[K, V]) set(key K, value V) {
+	now := c.now()
+	if _, ok := c.values[key]; ok {
+		c.values[key] = value
+		c.policy.Update(key, now)
+		return
+	}
+	for len(c.values) >= c.capacity {
+		victim, ok := c.policy.Victim()
+		if !ok {
+			break
+		}
+		c.delete(victim)
+		c.stats.Evictions++
+	}
+	c.values[key] = value
+	c.policy.Add(key, now)
+}
+
+// delete must be called with the mutex locked.
+func (c *Cache[K, V]) delete(key K) {
+	if _, ok := c.values[key]; !ok {
+		return
+	}
+	delete(c.values, key)
+	c.policy.Remove(key)
+}
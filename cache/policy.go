@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"time"
+)
+
+// --- Eviction policies ---
+/*
+
+	A Policy decides which key leaves the cache when it is full:
+
+	- LRU evicts the key that was used the longest time ago.
+	- LFU evicts the key that was used the fewest times (the least recently
+	used one when there is a tie).
+	- TTL makes keys expire some time after they were set, and evicts the
+	key that expires first when the cache is full.
+
+	Policies are not safe for concurrent use, the Cache locks before
+	calling them.
+*/
+
+type Policy[K comparable] interface {
+	// Add is called when a key enters the cache.
+	Add(key K, now time.Time)
+	// Touch is called when a key is read.
+	Touch(key K, now time.Time)
+	// Update is called when the value of a key is overwritten.
+	Update(key K, now time.Time)
+	// Remove is called when a key leaves the cache.
+	Remove(key K)
+	// Victim returns the key to evict, false when the policy has no keys.
+	Victim() (K, bool)
+	// Expired is true when the key must not be served anymore.
+	Expired(key K, now time.Time) bool
+}
+
+// --- LRU ---
+
+type lru[K comparable] struct {
+	order    *list.List // front is the most recently used
+	elements map[K]*list.Element
+}
+
+func NewLRU[K comparable]() Policy[K] {
+	return &lru[K]{
+		order:    list.New(),
+		elements: map[K]*list.Element{},
+	}
+}
+
+func (p *lru[K]) Add(key K, now time.Time) {
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *lru[K]) Touch(key K, now time.Time) {
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lru[K]) Update(key K, now time.Time) {
+	p.Touch(key, now)
+}
+
+func (p *lru[K]) Remove(key K) {
+	if e, ok := p.elements[key]; ok {
+		p.order.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lru[K]) Victim() (K, bool) {
+	back := p.order.Back()
+	if back == nil {
+		var zero K
+		return zero, false
+	}
+	return back.Value.(K), true
+}
+
+func (p *lru[K]) Expired(key K, now time.Time) bool {
+	return false
+}
+
+// --- LFU ---
+
+type lfu[K comparable] struct {
+	entries *keyHeap[K]
+	tick    int64
+}
+
+func NewLFU[K comparable]() Policy[K] {
+	return &lfu[K]{entries: newKeyHeap[K]()}
+}
+
+func (p *lfu[K]) Add(key K, now time.Time) {
+	p.tick++
+	p.entries.set(key, 1, p.tick)
+}
+
+func (p *lfu[K]) Touch(key K, now time.Time) {
+	entry, ok := p.entries.byKey[key]
+	if !ok {
+		return
+	}
+	p.tick++
+	p.entries.set(key, entry.primary+1, p.tick)
+}
+
+func (p *lfu[K]) Update(key K, now time.Time) {
+	p.Touch(key, now)
+}
+
+func (p *lfu[K]) Remove(key K) {
+	p.entries.remove(key)
+}
+
+func (p *lfu[K]) Victim() (K, bool) {
+	return p.entries.min()
+}
+
+func (p *lfu[K]) Expired(key K, now time.Time) bool {
+	return false
+}
+
+// --- TTL ---
+
+type ttl[K comparable] struct {
+	ttl     time.Duration
+	entries *keyHeap[K] // by expiration time
+	tick    int64
+}
+
+// NewTTL returns a policy where keys expire ttl after they were set.
+// Reading a key does not extend its life, setting it again does.
+func NewTTL[K comparable](timeToLive time.Duration) Policy[K] {
+	return &ttl[K]{ttl: timeToLive, entries: newKeyHeap[K]()}
+}
+
+func (p *ttl[K]) Add(key K, now time.Time) {
+	p.tick++
+	p.entries.set(key, now.Add(p.ttl).UnixNano(), p.tick)
+}
+
+func (p *ttl[K]) Touch(key K, now time.Time) {}
+
+// Update gives the key a new life.
+func (p *ttl[K]) Update(key K, now time.Time) {
+	p.Add(key, now)
+}
+
+func (p *ttl[K]) Remove(key K) {
+	p.entries.remove(key)
+}
+
+func (p *ttl[K]) Victim() (K, bool) {
+	return p.entries.min()
+}
+
+func (p *ttl[K]) Expired(key K, now time.Time) bool {
+	entry, ok := p.entries.byKey[key]
+	return ok && now.UnixNano() >= entry.primary
+}
+
+// --- keyHeap ---
+// keyHeap keeps the keys ordered by (primary, secondary), the smallest one first.
+
+type heapEntry[K comparable] struct {
+	key       K
+	primary   int64
+	secondary int64
+	index     int
+}
+
+type keyHeap[K comparable] struct {
+	entries []*heapEntry[K]
+	byKey   map[K]*heapEntry[K]
+}
+
+func newKeyHeap[K comparable]() *keyHeap[K] {
+	return &keyHeap[K]{byKey: map[K]*heapEntry[K]{}}
+}
+
+func (h *keyHeap[K]) set(key K, primary, secondary int64) {
+	if entry, ok := h.byKey[key]; ok {
+		entry.primary, entry.secondary = primary, secondary
+		heap.Fix(h, entry.index)
+		return
+	}
+	entry := &heapEntry[K]{key: key, primary: primary, secondary: secondary}
+	h.byKey[key] = entry
+	heap.Push(h, entry)
+}
+
+func (h *keyHeap[K]) remove(key K) {
+	if entry, ok := h.byKey[key]; ok {
+		heap.Remove(h, entry.index)
+		delete(h.byKey, key)
+	}
+}
+
+func (h *keyHeap[K]) min() (K, bool) {
+	if len(h.entries) == 0 {
+		var zero K
+		return zero, false
+	}
+	return h.entries[0].key, true
+}
+
+// heap.Interface, only used through the container/heap functions.
+
+func (h *keyHeap[K]) Len() int { return len(h.entries) }
+
+func (h *keyHeap[K]) Less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	if a.primary != b.primary {
+		return a.primary < b.primary
+	}
+	return a.secondary < b.secondary
+}
+
+func (h *keyHeap[K]) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+
+func (h *keyHeap[K]) Push(x any) {
+	entry := x.(*heapEntry[K])
+	entry.index = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *keyHeap[K]) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"sync"
 )
 
 // --- Error Handling ---
@@ -44,7 +45,36 @@ func convertToInteger(stringNumber string) int {
 */
 
 // example # 1
-var canSendMsg bool
+
+// canSendMsg used to be a single global bool, now every account can be
+// suspended on its own (for example by the dunning workflow when an account
+// does not pay its bills).
+var suspendedAccounts = struct {
+	mu       sync.Mutex
+	accounts map[string]bool
+}{
+	accounts: map[string]bool{},
+}
+
+// SuspendAccount blocks every message sent by the account.
+func SuspendAccount(account string) {
+	suspendedAccounts.mu.Lock()
+	defer suspendedAccounts.mu.Unlock()
+	suspendedAccounts.accounts[account] = true
+}
+
+// ReinstateAccount allows the account to send messages again.
+func ReinstateAccount(account string) {
+	suspendedAccounts.mu.Lock()
+	defer suspendedAccounts.mu.Unlock()
+	delete(suspendedAccounts.accounts, account)
+}
+
+func canSendMsg(account string) bool {
+	suspendedAccounts.mu.Lock()
+	defer suspendedAccounts.mu.Unlock()
+	return !suspendedAccounts.accounts[account]
+}
 
 type userError struct {
 	reason string
@@ -54,16 +84,30 @@ func (u userError) Error() string {
 	return fmt.Sprintf("there was an error with your account: %s", u.reason)
 }
 
-func sendSMS(msg string) error {
-	if !canSendMsg {
+func sendSMS(account, msg string) error {
+	if !canSendMsg(account) {
 		// Call custom error
 		return userError{
-			reason: "failed to send message.",
+			reason: "failed to send message, the account is suspended.",
 		}
 	}
 	return nil
 }
 
+// ErrAccountSuspended is what CanSendMsg returns for a suspended account,
+// userError is comparable so errors.Is works on it.
+var ErrAccountSuspended error = userError{
+	reason: "failed to send message, the account is suspended.",
+}
+
+// CanSendMsg is checked before every message is sent (see interfaces.Router.Send).
+func CanSendMsg(account string) error {
+	if !canSendMsg(account) {
+		return ErrAccountSuspended
+	}
+	return nil
+}
+
 type invalidOperationError struct {
 	reason string
 }
@@ -0,0 +1,69 @@
+package fsm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// --- Graphviz ---
+/*
+
+	DOT returns the machine in the Graphviz DOT language:
+
+		dot -Tpng machine.dot -o machine.png
+
+	The initial state has a double circle, the current state is filled and
+	guarded transitions are dashed.
+*/
+
+func (m *Machine[S, E]) DOT(name string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(name))
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=circle];\n")
+
+	seen := map[S]bool{}
+	var states []S
+	addState := func(s S) {
+		if !seen[s] {
+			seen[s] = true
+			states = append(states, s)
+		}
+	}
+	addState(m.initial)
+	for _, t := range m.order {
+		addState(t.From)
+		addState(t.To)
+	}
+	for _, s := range states {
+		var attrs []string
+		if s == m.initial {
+			attrs = append(attrs, "shape=doublecircle")
+		}
+		if s == m.current {
+			attrs = append(attrs, "style=filled")
+		}
+		fmt.Fprintf(&b, "\t%s", quote(s))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	for _, t := range m.order {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s", quote(t.From), quote(t.To), quote(t.Event))
+		if t.Guard != nil {
+			b.WriteString(", style=dashed")
+		}
+		b.WriteString("];\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func quote(v any) string {
+	return strconv.Quote(fmt.Sprint(v))
+}
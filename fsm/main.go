@@ -0,0 +1,195 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// --- Finite State Machines ---
+/*
+
+	Subscriptions, computers and accounts all go from one state to another:
+	a computer is off, we turn it on, now it is on. Writing those rules with
+	booleans and ifs everywhere ends with impossible states (on AND off).
+
+	A Machine has:
+
+	- typed states S and events E (usually string types with constants).
+	- transitions: "when in From and Event happens, go to To". A transition
+	can have a Guard that rejects it with an error.
+	- hooks that run when the machine leaves (OnExit) or enters (OnEnter) a state.
+	- a history of every change.
+
+	DOT (see dot.go) draws the machine with Graphviz.
+
+	A Machine is safe for concurrent use, but hooks run while the machine is
+	locked: they must not call the machine that runs them.
+*/
+
+var (
+	ErrInvalidTransition   = errors.New("invalid transition")
+	ErrDuplicateTransition = errors.New("duplicate transition")
+	ErrGuardRejected       = errors.New("transition rejected by guard")
+)
+
+type Transition[S, E comparable] struct {
+	From  S
+	Event E
+	To    S
+	// Guard is optional, a non-nil error rejects the transition.
+	Guard func() error
+}
+
+// Change is a transition that happened.
+type Change[S, E comparable] struct {
+	From  S
+	Event E
+	To    S
+	At    time.Time
+}
+
+// TransitionError is returned by Fire when the event can't happen in the current state.
+type TransitionError[S, E comparable] struct {
+	State S
+	Event E
+	Err   error // ErrInvalidTransition or the error of the guard wrapped with ErrGuardRejected
+}
+
+func (te *TransitionError[S, E]) Error() string {
+	return fmt.Sprintf("event %v in state %v: %v", te.Event, te.State, te.Err)
+}
+
+func (te *TransitionError[S, E]) Unwrap() error {
+	return te.Err
+}
+
+type transitionKey[S, E comparable] struct {
+	from  S
+	event E
+}
+
+type Machine[S, E comparable] struct {
+	mu          *sync.Mutex
+	current     S
+	initial     S
+	transitions map[transitionKey[S, E]]Transition[S, E]
+	order       []Transition[S, E] // in the order they were declared, for DOT and Permitted
+	onEnter     map[S][]func(Change[S, E])
+	onExit      map[S][]func(Change[S, E])
+	history     []Change[S, E]
+	now         func() time.Time
+}
+
+func NewMachine[S, E comparable](initial S, transitions ...Transition[S, E]) (*Machine[S, E], error) {
+	m := &Machine[S, E]{
+		mu:          &sync.Mutex{},
+		current:     initial,
+		initial:     initial,
+		transitions: map[transitionKey[S, E]]Transition[S, E]{},
+		onEnter:     map[S][]func(Change[S, E]){},
+		onExit:      map[S][]func(Change[S, E]){},
+		now:         time.Now,
+	}
+	for _, t := range transitions {
+		key := transitionKey[S, E]{from: t.From, event: t.Event}
+		if _, ok := m.transitions[key]; ok {
+			return nil, fmt.Errorf("%w: event %v from state %v", ErrDuplicateTransition, t.Event, t.From)
+		}
+		m.transitions[key] = t
+		m.order = append(m.order, t)
+	}
+	return m, nil
+}
+
+// OnEnter registers a hook that runs every time the machine enters state.
+func (m *Machine[S, E]) OnEnter(state S, hook func(Change[S, E])) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEnter[state] = append(m.onEnter[state], hook)
+}
+
+// OnExit registers a hook that runs every time the machine leaves state.
+func (m *Machine[S, E]) OnExit(state S, hook func(Change[S, E])) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onExit[state] = append(m.onExit[state], hook)
+}
+
+func (m *Machine[S, E]) Current() S {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+// Is reports whether the machine is in state.
+func (m *Machine[S, E]) Is(state S) bool {
+	return m.Current() == state
+}
+
+// Can reports whether event would be accepted now, guards included.
+func (m *Machine[S, E]) Can(event E) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.transition(event)
+	return err == nil
+}
+
+// Permitted returns the events that have a transition from the current state, guards are not checked.
+func (m *Machine[S, E]) Permitted() []E {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []E
+	for _, t := range m.order {
+		if t.From == m.current {
+			events = append(events, t.Event)
+		}
+	}
+	return events
+}
+
+// Fire moves the machine with event: exit hooks of the old state run first,
+// then the state changes and the enter hooks of the new state run.
+func (m *Machine[S, E]) Fire(event E) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.transition(event)
+	if err != nil {
+		return err
+	}
+	change := Change[S, E]{From: m.current, Event: event, To: t.To, At: m.now()}
+	for _, hook := range m.onExit[change.From] {
+		hook(change)
+	}
+	m.current = t.To
+	m.history = append(m.history, change)
+	for _, hook := range m.onEnter[change.To] {
+		hook(change)
+	}
+	return nil
+}
+
+func (m *Machine[S, E]) History() []Change[S, E] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Change[S, E](nil), m.history...)
+}
+
+// transition must be called with the mutex locked.
+func (m *Machine[S, E]) transition(event E) (Transition[S, E], error) {
+	t, ok := m.transitions[transitionKey[S, E]{from: m.current, event: event}]
+	if !ok {
+		return t, &TransitionError[S, E]{State: m.current, Event: event, Err: ErrInvalidTransition}
+	}
+	if t.Guard != nil {
+		if err := t.Guard(); err != nil {
+			return t, &TransitionError[S, E]{
+				State: m.current,
+				Event: event,
+				Err:   fmt.Errorf("%w: %w", ErrGuardRejected, err),
+			}
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,220 @@
+package generics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+// --- Plan Catalog ---
+/*
+
+	userBiller and orgBiller only know the magic "pro" plan, any other plan
+	silently falls back to a default price.
+
+	The planCatalog moves the plans out of the code and into a JSON file
+	(see plans.json) that defines, for every plan:
+
+	- its name
+	- its price for each kind of customer ("user" or "org")
+	- its feature limits (for example the number of emails per period)
+
+	The billerRegistry uses the catalog to resolve the right biller[C]
+	for a customer, so adding a new plan only means editing the file.
+	Unknown plans are an error instead of a silent default.
+*/
+
+var (
+	errUnknownPlan       = errors.New("unknown plan")
+	errNoPriceForKind    = errors.New("plan has no price for customer kind")
+	errUnknownLimit      = errors.New("plan has no such feature limit")
+	errInvalidPlanConfig = errors.New("invalid plan catalog")
+	errNoCustomerKind    = errors.New("customer type has no kind")
+)
+
+// Customer kinds used as keys of planDefinition.Prices.
+const (
+	userCustomerKind = "user"
+	orgCustomerKind  = "org"
+)
+
+// kindedCustomer is a customer that knows which price of a plan applies to it.
+type kindedCustomer interface {
+	customer
+	customerKind() string
+}
+
+func (u user) customerKind() string {
+	return userCustomerKind
+}
+
+func (o org) customerKind() string {
+	return orgCustomerKind
+}
+
+// kindOf returns the kind of the customers of type C. A zero C can be a nil
+// pointer (C is *user), so customerKind is called on a new value instead.
+func kindOf[C kindedCustomer]() (string, error) {
+	var c C
+	switch t := reflect.TypeFor[C](); t.Kind() {
+	case reflect.Pointer:
+		c = reflect.New(t.Elem()).Interface().(C)
+	case reflect.Interface:
+		// any customer type fits, the kind is only known from a value
+		return "", fmt.Errorf("%w: %s", errNoCustomerKind, t)
+	}
+	return c.customerKind(), nil
+}
+
+type planDefinition struct {
+	Name   string             `json:"name"`
+	Prices map[string]float64 `json:"prices"`
+	Limits map[string]int     `json:"limits"`
+	// Currency of Prices, plans without it are priced in defaultCurrency.
+	Currency currency `json:"currency,omitempty"`
+	// LocalPrices are the prices per customer kind in other currencies,
+	// they are used instead of converting Prices (see currency.go).
+	LocalPrices map[currency]map[string]float64 `json:"local_prices,omitempty"`
+}
+
+func (pd planDefinition) price(kind string) (float64, error) {
+	price, ok := pd.Prices[kind]
+	if !ok {
+		return 0.0, fmt.Errorf("%w: %s plan for %s", errNoPriceForKind, pd.Name, kind)
+	}
+	return price, nil
+}
+
+func (pd planDefinition) limit(feature string) (int, error) {
+	limit, ok := pd.Limits[feature]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s plan has no %s limit", errUnknownLimit, pd.Name, feature)
+	}
+	return limit, nil
+}
+
+type planCatalog struct {
+	plans map[string]planDefinition
+}
+
+// loadPlanCatalog reads a catalog like:
+//
+//	{"plans": [{"name": "pro", "prices": {"user": 100, "org": 3000}, "limits": {"emails": 10000}}]}
+func loadPlanCatalog(r io.Reader) (planCatalog, error) {
+	var file struct {
+		Plans []planDefinition `json:"plans"`
+	}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return planCatalog{}, fmt.Errorf("%w: %v", errInvalidPlanConfig, err)
+	}
+
+	catalog := planCatalog{plans: map[string]planDefinition{}}
+	for _, plan := range file.Plans {
+		if plan.Name == "" {
+			return planCatalog{}, fmt.Errorf("%w: plan without a name", errInvalidPlanConfig)
+		}
+		if _, ok := catalog.plans[plan.Name]; ok {
+			return planCatalog{}, fmt.Errorf("%w: duplicated plan %s", errInvalidPlanConfig, plan.Name)
+		}
+		for kind, price := range plan.Prices {
+			if price < 0 {
+				return planCatalog{}, fmt.Errorf("%w: negative %s price for plan %s", errInvalidPlanConfig, kind, plan.Name)
+			}
+		}
+		if plan.Currency == "" {
+			plan.Currency = defaultCurrency
+		}
+		plan.Currency = normalizeCurrency(plan.Currency)
+		localPrices := make(map[currency]map[string]float64, len(plan.LocalPrices))
+		for cur, prices := range plan.LocalPrices {
+			cur = normalizeCurrency(cur)
+			for kind, price := range prices {
+				if price < 0 {
+					return planCatalog{}, fmt.Errorf("%w: negative %s %s price for plan %s", errInvalidPlanConfig, cur, kind, plan.Name)
+				}
+			}
+			localPrices[cur] = prices
+		}
+		plan.LocalPrices = localPrices
+		catalog.plans[plan.Name] = plan
+	}
+	return catalog, nil
+}
+
+func loadPlanCatalogFile(path string) (planCatalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return planCatalog{}, err
+	}
+	defer f.Close()
+	return loadPlanCatalog(f)
+}
+
+func (pc planCatalog) plan(name string) (planDefinition, error) {
+	plan, ok := pc.plans[name]
+	if !ok {
+		return planDefinition{}, fmt.Errorf("%w: %s", errUnknownPlan, name)
+	}
+	return plan, nil
+}
+
+// --- Biller Registry ---
+
+// catalogBiller implements the biller interface using the price of a catalog plan.
+type catalogBiller[C kindedCustomer] struct {
+	plan   planDefinition
+	kind   string
+	amount float64
+}
+
+func (cb catalogBiller[C]) Charge(c C) bill {
+	return bill{
+		Customer: c,
+		Amount:   cb.amount,
+	}
+}
+
+func (cb catalogBiller[C]) Name() string {
+	return fmt.Sprintf("%s %s biller", cb.plan.Name, cb.kind)
+}
+
+type billerRegistry struct {
+	catalog planCatalog
+}
+
+func newBillerRegistry(catalog planCatalog) billerRegistry {
+	return billerRegistry{catalog: catalog}
+}
+
+// resolveBiller returns the biller of a plan for customers of type C,
+// for example resolveBiller[org](registry, "pro").
+// Methods can not have type parameters, that's why this is a function.
+func resolveBiller[C kindedCustomer](br billerRegistry, planName string) (biller[C], error) {
+	plan, err := br.catalog.plan(planName)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := kindOf[C]()
+	if err != nil {
+		return nil, err
+	}
+	amount, err := plan.price(kind)
+	if err != nil {
+		return nil, err
+	}
+	return catalogBiller[C]{plan: plan, kind: kind, amount: amount}, nil
+}
+
+// chargeCustomer resolves the biller of the plan and charges the customer with it.
+func chargeCustomer[C kindedCustomer](br billerRegistry, planName string, c C) (bill, error) {
+	b, err := resolveBiller[C](br, planName)
+	if err != nil {
+		return bill{}, err
+	}
+	return b.Charge(c), nil
+}
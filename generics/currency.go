@@ -0,0 +1,217 @@
+package generics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Multiple Currencies ---
+/*
+
+	All our amounts used to be unitless floats. Now every customer has a
+	billing currency in their billingProfile and a plan can be priced in
+	that currency in two ways:
+
+	1) The plan has a local price for the currency in the catalog
+	(planDefinition.LocalPrices), then that price is used as it is.
+	2) Otherwise the price of the plan is converted with the exchange rates
+	in force on the billing date. The rates are loaded from a local file
+	(see exchange_rates.json) and the conversion is kept in the bill,
+	with the rate that was used, so it can always be explained.
+*/
+
+type currency string
+
+const defaultCurrency currency = "USD"
+
+var (
+	errNoExchangeRate       = errors.New("no exchange rate")
+	errInvalidExchangeRates = errors.New("invalid exchange rates")
+)
+
+type money struct {
+	amount   float64
+	currency currency
+}
+
+func (m money) String() string {
+	return fmt.Sprintf("%.2f %s", m.amount, m.currency)
+}
+
+// conversion records how an amount was converted to another currency.
+type conversion struct {
+	from     money
+	to       money
+	rate     float64   // units of to.currency for one unit of from.currency
+	rateDate time.Time // publication date of the oldest rate that was used
+}
+
+type datedRate struct {
+	date time.Time
+	rate float64 // units of the currency for one unit of the base currency
+}
+
+type exchangeRateTable struct {
+	base  currency
+	rates map[currency][]datedRate // sorted by date
+}
+
+// loadExchangeRates reads a table like:
+//
+//	{"base": "USD", "rates": [{"date": "2026-01-02", "currency": "EUR", "rate": 0.91}]}
+func loadExchangeRates(r io.Reader) (exchangeRateTable, error) {
+	var file struct {
+		Base  currency `json:"base"`
+		Rates []struct {
+			Date     string   `json:"date"`
+			Currency currency `json:"currency"`
+			Rate     float64  `json:"rate"`
+		} `json:"rates"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return exchangeRateTable{}, fmt.Errorf("%w: %v", errInvalidExchangeRates, err)
+	}
+	if file.Base == "" {
+		return exchangeRateTable{}, fmt.Errorf("%w: missing base currency", errInvalidExchangeRates)
+	}
+	table := exchangeRateTable{
+		base:  normalizeCurrency(file.Base),
+		rates: map[currency][]datedRate{},
+	}
+	for i, entry := range file.Rates {
+		if entry.Rate <= 0 {
+			return exchangeRateTable{}, fmt.Errorf("%w: rate %d must be greater than zero", errInvalidExchangeRates, i)
+		}
+		date, err := time.Parse(time.DateOnly, entry.Date)
+		if err != nil {
+			return exchangeRateTable{}, fmt.Errorf("%w: rate %d: %v", errInvalidExchangeRates, i, err)
+		}
+		cur := normalizeCurrency(entry.Currency)
+		table.rates[cur] = append(table.rates[cur], datedRate{date: date, rate: entry.Rate})
+	}
+	for _, rates := range table.rates {
+		sort.Slice(rates, func(i, j int) bool {
+			return rates[i].date.Before(rates[j].date)
+		})
+	}
+	return table, nil
+}
+
+func loadExchangeRatesFile(path string) (exchangeRateTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return exchangeRateTable{}, err
+	}
+	defer f.Close()
+	return loadExchangeRates(f)
+}
+
+// rateFromBase returns the latest rate of the currency published on or before the date.
+func (ert exchangeRateTable) rateFromBase(cur currency, at time.Time) (datedRate, error) {
+	if cur == ert.base {
+		return datedRate{date: at, rate: 1}, nil
+	}
+	rates := ert.rates[cur]
+	i := sort.Search(len(rates), func(i int) bool {
+		return rates[i].date.After(at)
+	})
+	if i == 0 {
+		return datedRate{}, fmt.Errorf("%w: %s on %s", errNoExchangeRate, cur, at.Format(time.DateOnly))
+	}
+	return rates[i-1], nil
+}
+
+// convert converts an amount with the rates in force at the given time,
+// going through the base currency when none of the currencies is the base.
+func (ert exchangeRateTable) convert(m money, to currency, at time.Time) (conversion, error) {
+	from := normalizeCurrency(m.currency)
+	to = normalizeCurrency(to)
+	if from == to {
+		return conversion{from: m, to: m, rate: 1, rateDate: at}, nil
+	}
+	fromRate, err := ert.rateFromBase(from, at)
+	if err != nil {
+		return conversion{}, err
+	}
+	toRate, err := ert.rateFromBase(to, at)
+	if err != nil {
+		return conversion{}, err
+	}
+	rate := toRate.rate / fromRate.rate
+	rateDate := at
+	for _, used := range []datedRate{fromRate, toRate} {
+		if used.date.Before(rateDate) {
+			rateDate = used.date
+		}
+	}
+	return conversion{
+		from:     m,
+		to:       money{amount: roundCents(m.amount * rate), currency: to},
+		rate:     rate,
+		rateDate: rateDate,
+	}, nil
+}
+
+func normalizeCurrency(c currency) currency {
+	return currency(strings.ToUpper(string(c)))
+}
+
+// --- Billing in the customer's currency ---
+
+// currencyBill is a bill whose Amount is in the currency of the customer.
+type currencyBill struct {
+	bill       bill
+	currency   currency
+	conversion *conversion // nil when the plan had a local price
+}
+
+// priceInCurrency returns the price of the plan for a customer kind in a currency.
+func priceInCurrency(plan planDefinition, kind string, to currency, rates exchangeRateTable, at time.Time) (money, *conversion, error) {
+	to = normalizeCurrency(to)
+	if local, ok := plan.LocalPrices[to][kind]; ok {
+		return money{amount: local, currency: to}, nil, nil
+	}
+	price, err := plan.price(kind)
+	if err != nil {
+		return money{}, nil, err
+	}
+	base := money{amount: price, currency: plan.Currency}
+	if normalizeCurrency(base.currency) == to {
+		return base, nil, nil
+	}
+	conv, err := rates.convert(base, to, at)
+	if err != nil {
+		return money{}, nil, err
+	}
+	return conv.to, &conv, nil
+}
+
+// chargeInCurrency charges a customer for a plan in the currency of their billing profile.
+func chargeInCurrency[C kindedCustomer](br billerRegistry, rates exchangeRateTable, planName string, c C, profile billingProfile, at time.Time) (currencyBill, error) {
+	plan, err := br.catalog.plan(planName)
+	if err != nil {
+		return currencyBill{}, err
+	}
+	cur := profile.currency
+	if cur == "" {
+		cur = defaultCurrency
+	}
+	price, conv, err := priceInCurrency(plan, c.customerKind(), cur, rates, at)
+	if err != nil {
+		return currencyBill{}, err
+	}
+	return currencyBill{
+		bill: bill{
+			Customer: c,
+			Amount:   price.amount,
+		},
+		currency:   price.currency,
+		conversion: conv,
+	}, nil
+}
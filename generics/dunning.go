@@ -0,0 +1,292 @@
+package generics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	mailerrors "github.com/daniela2001-png/freecodecamp_go_course/errors"
+	"github.com/daniela2001-png/freecodecamp_go_course/interfaces"
+)
+
+// --- Dunning ---
+/*
+
+	When chargeForLineItem returns "insufficient funds" we used to give up.
+	Dunning is the process of chasing those failed charges:
+
+	1) The charge is retried on a configurable cadence
+	(for example 1 day, 3 days and 7 days after each failure).
+	2) After every failed retry the customer gets a reminder by email
+	and, when we know their phone number, by SMS.
+	3) The account moves through these states:
+
+		active -> grace -> pastDue -> suspended
+
+	A suspended account can not send messages anymore (see
+	errors.SuspendAccount). As soon as a retry succeeds the account goes
+	back to active and it is reinstated.
+*/
+
+type dunningState string
+
+const (
+	dunningActive    dunningState = "active"
+	dunningGrace     dunningState = "grace"
+	dunningPastDue   dunningState = "past due"
+	dunningSuspended dunningState = "suspended"
+)
+
+var (
+	errNoDunningCase       = errors.New("no dunning case for customer")
+	errDunningCaseOpen     = errors.New("customer already has an open dunning case")
+	errInvalidDunningCycle = errors.New("dunning policy needs at least one retry")
+)
+
+type dunningPolicy struct {
+	// retryCadence is the delay before each retry, the last delay is reused
+	// when there are more retries than delays.
+	retryCadence []time.Duration
+	// graceRetries is the number of failed retries before the account is past due.
+	graceRetries int
+	// pastDueRetries is the number of failed retries while past due before the account is suspended.
+	pastDueRetries int
+}
+
+func (dp dunningPolicy) delay(attempt int) time.Duration {
+	if attempt < len(dp.retryCadence) {
+		return dp.retryCadence[attempt]
+	}
+	return dp.retryCadence[len(dp.retryCadence)-1]
+}
+
+// stateAfter returns the state of an account after a number of failed retries.
+func (dp dunningPolicy) stateAfter(failedRetries int) dunningState {
+	switch {
+	case failedRetries < dp.graceRetries:
+		return dunningGrace
+	case failedRetries < dp.graceRetries+dp.pastDueRetries:
+		return dunningPastDue
+	default:
+		return dunningSuspended
+	}
+}
+
+type dunningContact struct {
+	email       string
+	phoneNumber int // zero when we don't know it, reminders only go by email
+}
+
+type dunningAttempt struct {
+	at  time.Time
+	err error // nil when the retry succeeded
+}
+
+type dunningCase struct {
+	customer      customer
+	contact       dunningContact
+	item          lineItem
+	state         dunningState
+	failedRetries int
+	nextAttempt   time.Time
+	history       []dunningAttempt
+	retrying      bool // the charge is being retried, the mutex is not locked meanwhile
+}
+
+// dunningNotifier sends the reminders of the dunning workflow.
+type dunningNotifier interface {
+	remind(contact dunningContact, state dunningState, text string) error
+}
+
+// messagingNotifier sends the reminders using the messaging code of the interfaces package.
+type messagingNotifier struct {
+	sender string
+}
+
+func (mn messagingNotifier) remind(contact dunningContact, state dunningState, text string) error {
+	subject := fmt.Sprintf("Your Mailio account is %s", state)
+	if err := interfaces.SendMail(mn.sender, contact.email, subject, text); err != nil {
+		return err
+	}
+	if contact.phoneNumber == 0 {
+		return nil
+	}
+	return interfaces.SendSMS(mn.sender, contact.phoneNumber, text)
+}
+
+type dunningManager struct {
+	mu       *sync.Mutex
+	policy   dunningPolicy
+	cases    map[string]*dunningCase
+	retry    func(c customer, item lineItem) error
+	notifier dunningNotifier
+}
+
+// newDunningManager needs the function used to retry a charge, for example
+// a closure around chargeWithGateway.
+func newDunningManager(policy dunningPolicy, retry func(c customer, item lineItem) error, notifier dunningNotifier) (dunningManager, error) {
+	if len(policy.retryCadence) == 0 {
+		return dunningManager{}, errInvalidDunningCycle
+	}
+	return dunningManager{
+		mu:       &sync.Mutex{},
+		policy:   policy,
+		cases:    map[string]*dunningCase{},
+		retry:    retry,
+		notifier: notifier,
+	}, nil
+}
+
+// chargeOrDun calls chargeForLineItem and opens a dunning case when the charge fails.
+func chargeOrDun[T lineItem](dm dunningManager, c customer, phoneNumber int, newItem T, oldItems []T, balance float64, at time.Time) ([]T, float64, error) {
+	items, newBalance, err := chargeForLineItem(newItem, oldItems, balance)
+	if err != nil {
+		contact := dunningContact{email: c.GetBillingEmail(), phoneNumber: phoneNumber}
+		if openErr := dm.open(c, contact, newItem, at); openErr != nil {
+			return nil, 0.0, fmt.Errorf("%w (dunning: %v)", err, openErr)
+		}
+	}
+	return items, newBalance, err
+}
+
+// dunningReminder is a reminder decided while the mutex is locked and sent after it is unlocked.
+type dunningReminder struct {
+	contact dunningContact
+	state   dunningState
+	text    string
+}
+
+func (dm dunningManager) send(r dunningReminder) error {
+	return dm.notifier.remind(r.contact, r.state, r.text)
+}
+
+// open starts the dunning of a failed charge, the account enters the grace state.
+func (dm dunningManager) open(c customer, contact dunningContact, item lineItem, at time.Time) error {
+	dm.mu.Lock()
+	if _, ok := dm.cases[contact.email]; ok {
+		dm.mu.Unlock()
+		return errDunningCaseOpen
+	}
+	dc := &dunningCase{
+		customer:    c,
+		contact:     contact,
+		item:        item,
+		state:       dunningGrace,
+		nextAttempt: at.Add(dm.policy.delay(0)),
+	}
+	dm.cases[contact.email] = dc
+	reminder := dunningReminder{
+		contact: contact,
+		state:   dc.state,
+		text: fmt.Sprintf("We could not charge %.2f for your %s. We will try again on %s.",
+			item.GetCost(), item.GetName(), dc.nextAttempt.Format(time.DateOnly)),
+	}
+	dm.mu.Unlock()
+	return dm.send(reminder)
+}
+
+// runDue retries every charge that is due at the given time.
+// It returns the emails of the accounts that changed their state.
+// The retries and the reminders go over the network, so the mutex is only
+// locked to pick the due cases and to save the result of every retry.
+func (dm dunningManager) runDue(at time.Time) ([]string, error) {
+	dm.mu.Lock()
+	var due []*dunningCase
+	for _, dc := range dm.cases {
+		if dc.retrying || dc.state == dunningSuspended || at.Before(dc.nextAttempt) {
+			continue
+		}
+		dc.retrying = true // another runDue doesn't retry it twice
+		due = append(due, dc)
+	}
+	dm.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool {
+		// to retry the accounts always in the same order
+		return due[i].contact.email < due[j].contact.email
+	})
+
+	var changed []string
+	var errs []error
+	for _, dc := range due {
+		err := dm.retry(dc.customer, dc.item)
+
+		dm.mu.Lock()
+		previous := dc.state
+		reminder, ok := dm.retried(dc, at, err)
+		stateChanged := dc.state != previous
+		dm.mu.Unlock()
+
+		if stateChanged {
+			changed = append(changed, dc.contact.email)
+		}
+		if !ok {
+			continue
+		}
+		if err := dm.send(reminder); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// retried must be called with the mutex locked, it saves the result of a retry.
+// ok is false when the case was settled while the charge was retried.
+func (dm dunningManager) retried(dc *dunningCase, at time.Time, err error) (reminder dunningReminder, ok bool) {
+	dc.retrying = false
+	if dm.cases[dc.contact.email] != dc {
+		return dunningReminder{}, false
+	}
+	dc.history = append(dc.history, dunningAttempt{at: at, err: err})
+	if err == nil {
+		return dm.recover(dc), true
+	}
+
+	dc.failedRetries++
+	dc.state = dm.policy.stateAfter(dc.failedRetries)
+	if dc.state == dunningSuspended {
+		mailerrors.SuspendAccount(dc.contact.email)
+		text := fmt.Sprintf("Your account was suspended because we could not charge %.2f for your %s. Pay it to send messages again.",
+			dc.item.GetCost(), dc.item.GetName())
+		return dunningReminder{contact: dc.contact, state: dc.state, text: text}, true
+	}
+	dc.nextAttempt = at.Add(dm.policy.delay(dc.failedRetries))
+	text := fmt.Sprintf("We still could not charge %.2f for your %s. We will try again on %s.",
+		dc.item.GetCost(), dc.item.GetName(), dc.nextAttempt.Format(time.DateOnly))
+	return dunningReminder{contact: dc.contact, state: dc.state, text: text}, true
+}
+
+// settle closes the case of a customer that paid by other means (for example from the suspended state).
+func (dm dunningManager) settle(email string) error {
+	dm.mu.Lock()
+	dc, ok := dm.cases[email]
+	if !ok {
+		dm.mu.Unlock()
+		return errNoDunningCase
+	}
+	reminder := dm.recover(dc)
+	dm.mu.Unlock()
+	return dm.send(reminder)
+}
+
+// recover must be called with the mutex locked, it returns the reminder to send.
+func (dm dunningManager) recover(dc *dunningCase) dunningReminder {
+	delete(dm.cases, dc.contact.email)
+	if dc.state == dunningSuspended {
+		mailerrors.ReinstateAccount(dc.contact.email)
+	}
+	dc.state = dunningActive
+	text := fmt.Sprintf("Thanks! We received %.2f for your %s.", dc.item.GetCost(), dc.item.GetName())
+	return dunningReminder{contact: dc.contact, state: dc.state, text: text}
+}
+
+// state returns the dunning state of an account, accounts without a case are active.
+func (dm dunningManager) state(email string) dunningState {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if dc, ok := dm.cases[email]; ok {
+		return dc.state
+	}
+	return dunningActive
+}
@@ -0,0 +1,56 @@
+package generics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/daniela2001-png/freecodecamp_go_course/payments"
+)
+
+// --- Charging Through a Payment Gateway ---
+/*
+
+	chargeForLineItem only checks an in-memory balance.
+	chargeWithGateway does the same job against a payments.PaymentGateway:
+	it authorizes the cost of the line item on the customer's payment
+	method and captures it.
+
+	The caller passes ONE idempotency key per charge. The keys of the
+	authorize, capture and void calls are derived from it, so retrying the
+	whole charge with the same key never bills the customer twice.
+*/
+
+var errMissingChargeKey = errors.New("a charge needs an idempotency key")
+
+func chargeWithGateway[T lineItem](ctx context.Context, gw payments.PaymentGateway, c customer, paymentMethod string, newItem T, oldItems []T, idempotencyKey string) ([]T, payments.Transaction, error) {
+	if idempotencyKey == "" {
+		return nil, payments.Transaction{}, errMissingChargeKey
+	}
+	auth, err := gw.Authorize(ctx, payments.AuthorizeRequest{
+		IdempotencyKey: idempotencyKey + "/authorize",
+		CustomerEmail:  c.GetBillingEmail(),
+		PaymentMethod:  paymentMethod,
+		Amount:         newItem.GetCost(),
+		Description:    newItem.GetName(),
+	})
+	if err != nil {
+		return nil, payments.Transaction{}, err
+	}
+	capture, err := gw.Capture(ctx, payments.CaptureRequest{
+		IdempotencyKey:  idempotencyKey + "/capture",
+		AuthorizationID: auth.ID,
+		Amount:          auth.Amount,
+	})
+	if err != nil {
+		// release the hold on the customer's payment method
+		if _, voidErr := gw.Void(ctx, payments.VoidRequest{
+			IdempotencyKey:  idempotencyKey + "/void",
+			AuthorizationID: auth.ID,
+		}); voidErr != nil {
+			return nil, payments.Transaction{}, fmt.Errorf("%w (void failed: %v)", err, voidErr)
+		}
+		return nil, payments.Transaction{}, err
+	}
+	return append(oldItems, newItem), capture, nil
+}
@@ -0,0 +1,297 @@
+package generics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- Inventory ---
+/*
+
+	bookStore and toyStore just append every product to a sold slice,
+	so they can sell forever. A real store has a stock for each product.
+
+	inventory[P] is a generic store[P] that keeps a stock count for every
+	product (products are identified by their Name()). It is safe for
+	concurrent use:
+
+	- Sell fails with an outOfStockError when there is nothing left.
+	- Restock adds units of a product.
+	- Reserve holds units for a while, the reservation must be committed
+	(which sells the units) or released before it expires. Expired
+	reservations give their units back to the stock.
+
+	Every sale is recorded so we can build sales reports per product and
+	per period using product.Price().
+*/
+
+var (
+	errInvalidQuantity       = errors.New("quantity must be greater than zero")
+	errReservationNotFound   = errors.New("reservation not found")
+	errReservationExpired    = errors.New("reservation expired")
+	errInvalidReservationTTL = errors.New("reservation ttl must be greater than zero")
+)
+
+type outOfStockError struct {
+	product   string
+	requested int
+	available int
+}
+
+func (oos outOfStockError) Error() string {
+	return fmt.Sprintf("%s is out of stock: requested %d, available %d", oos.product, oos.requested, oos.available)
+}
+
+// expiredReservationRetention is how long an expired reservation is kept (without
+// units) so Commit can say it expired, after that it is forgotten.
+const expiredReservationRetention = 24 * time.Hour
+
+type reservation[P product] struct {
+	product   P
+	quantity  int
+	expiresAt time.Time
+}
+
+type sale[P product] struct {
+	product  P
+	quantity int
+	soldAt   time.Time
+}
+
+type inventory[P product] struct {
+	mu           *sync.Mutex
+	stock        map[string]int
+	reservations map[string]reservation[P]
+	sales        []sale[P]
+	nextID       int
+	now          func() time.Time
+}
+
+func newInventory[P product]() *inventory[P] {
+	return &inventory[P]{
+		mu:           &sync.Mutex{},
+		stock:        map[string]int{},
+		reservations: map[string]reservation[P]{},
+		now:          time.Now,
+	}
+}
+
+// Restock adds units of a product to the stock.
+func (inv *inventory[P]) Restock(p P, quantity int) error {
+	if quantity <= 0 {
+		return errInvalidQuantity
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.stock[p.Name()] += quantity
+	return nil
+}
+
+// Sell sells a single unit of the product, so inventory[P] is a store[P].
+func (inv *inventory[P]) Sell(p P) error {
+	return inv.SellQuantity(p, 1)
+}
+
+// SellQuantity sells many units of the product at once, it sells all of them or none.
+func (inv *inventory[P]) SellQuantity(p P, quantity int) error {
+	if quantity <= 0 {
+		return errInvalidQuantity
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	now := inv.now()
+	inv.expireReservations(now)
+	if err := inv.take(p, quantity); err != nil {
+		return err
+	}
+	inv.sales = append(inv.sales, sale[P]{product: p, quantity: quantity, soldAt: now})
+	return nil
+}
+
+// Available returns the units that can be sold or reserved right now.
+func (inv *inventory[P]) Available(p P) int {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.expireReservations(inv.now())
+	return inv.stock[p.Name()]
+}
+
+// Reserve takes units out of the stock until the reservation is committed,
+// released or it expires after ttl.
+func (inv *inventory[P]) Reserve(p P, quantity int, ttl time.Duration) (reservationID string, err error) {
+	if quantity <= 0 {
+		return "", errInvalidQuantity
+	}
+	if ttl <= 0 {
+		return "", errInvalidReservationTTL
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	now := inv.now()
+	inv.expireReservations(now)
+	if err := inv.take(p, quantity); err != nil {
+		return "", err
+	}
+	inv.nextID++
+	reservationID = fmt.Sprintf("res-%d", inv.nextID)
+	inv.reservations[reservationID] = reservation[P]{
+		product:   p,
+		quantity:  quantity,
+		expiresAt: now.Add(ttl),
+	}
+	return reservationID, nil
+}
+
+// Commit sells the units held by a reservation.
+func (inv *inventory[P]) Commit(reservationID string) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	now := inv.now()
+	r, err := inv.popReservation(reservationID, now)
+	if err != nil {
+		return err
+	}
+	inv.sales = append(inv.sales, sale[P]{product: r.product, quantity: r.quantity, soldAt: now})
+	return nil
+}
+
+// Release gives the units held by a reservation back to the stock.
+func (inv *inventory[P]) Release(reservationID string) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	r, err := inv.popReservation(reservationID, inv.now())
+	if err != nil {
+		return err
+	}
+	inv.stock[r.product.Name()] += r.quantity
+	return nil
+}
+
+// take must be called with the mutex locked.
+func (inv *inventory[P]) take(p P, quantity int) error {
+	name := p.Name()
+	if available := inv.stock[name]; available < quantity {
+		return outOfStockError{
+			product:   name,
+			requested: quantity,
+			available: available,
+		}
+	}
+	inv.stock[name] -= quantity
+	return nil
+}
+
+// popReservation must be called with the mutex locked.
+func (inv *inventory[P]) popReservation(reservationID string, now time.Time) (reservation[P], error) {
+	r, ok := inv.reservations[reservationID]
+	if !ok {
+		return reservation[P]{}, errReservationNotFound
+	}
+	delete(inv.reservations, reservationID)
+	if !now.Before(r.expiresAt) {
+		inv.stock[r.product.Name()] += r.quantity
+		return reservation[P]{}, errReservationExpired
+	}
+	return r, nil
+}
+
+// expireReservations must be called with the mutex locked.
+// Expired reservations are kept (without units) for expiredReservationRetention
+// so Commit can report them as expired, then they are dropped.
+func (inv *inventory[P]) expireReservations(now time.Time) {
+	for id, r := range inv.reservations {
+		if now.Before(r.expiresAt) {
+			continue
+		}
+		if r.quantity == 0 {
+			if now.Sub(r.expiresAt) >= expiredReservationRetention {
+				delete(inv.reservations, id)
+			}
+			continue
+		}
+		inv.stock[r.product.Name()] += r.quantity
+		r.quantity = 0
+		inv.reservations[id] = r
+	}
+}
+
+// --- Sales Reports ---
+
+type salesLine struct {
+	name    string
+	units   int
+	revenue float64
+}
+
+type periodSales struct {
+	// period is the start of the period as "2006-01-02 15:04:05", without location:
+	// the sales of the same day recorded in two locations are in the same period.
+	period string
+	lines  []salesLine
+	total  float64
+}
+
+// SalesByProduct returns the units sold and the revenue of every product sorted by name.
+func (inv *inventory[P]) SalesByProduct() []salesLine {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return summarizeSales(inv.sales)
+}
+
+// SalesByPeriod groups the sales by the period returned by periodStart
+// (for example dailyPeriod or monthlyPeriod) sorted from oldest to newest.
+func (inv *inventory[P]) SalesByPeriod(periodStart func(time.Time) time.Time) []periodSales {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	byPeriod := map[string][]sale[P]{}
+	for _, s := range inv.sales {
+		period := periodStart(s.soldAt).Format(time.DateTime)
+		byPeriod[period] = append(byPeriod[period], s)
+	}
+	report := make([]periodSales, 0, len(byPeriod))
+	for period, sales := range byPeriod {
+		lines := summarizeSales(sales)
+		total := 0.0
+		for _, line := range lines {
+			total += line.revenue
+		}
+		report = append(report, periodSales{period: period, lines: lines, total: total})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].period < report[j].period
+	})
+	return report
+}
+
+func summarizeSales[P product](sales []sale[P]) []salesLine {
+	byName := map[string]*salesLine{}
+	for _, s := range sales {
+		name := s.product.Name()
+		line, ok := byName[name]
+		if !ok {
+			line = &salesLine{name: name}
+			byName[name] = line
+		}
+		line.units += s.quantity
+		line.revenue += float64(s.quantity) * s.product.Price()
+	}
+	lines := make([]salesLine, 0, len(byName))
+	for _, line := range byName {
+		lines = append(lines, *line)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].name < lines[j].name
+	})
+	return lines
+}
+
+func dailyPeriod(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func monthlyPeriod(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
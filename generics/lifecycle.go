@@ -0,0 +1,81 @@
+package generics
+
+import (
+	"errors"
+
+	"github.com/daniela2001-png/freecodecamp_go_course/fsm"
+)
+
+// --- Subscription Lifecycle ---
+/*
+
+	A subscription starts in a trial, then it is activated, it can be
+	paused and resumed, and finally it is canceled. The rules live in a
+	state machine (see the fsm package) instead of booleans:
+
+	trialing --activate--> active --pause--> paused --resume--> active
+	trialing, active, paused --cancel--> canceled
+
+	Only monthly subscriptions can be paused, yearly ones are paid upfront.
+	Only active subscriptions are billed.
+*/
+
+type subscriptionState string
+
+const (
+	subscriptionTrialing subscriptionState = "trialing"
+	subscriptionActive   subscriptionState = "active"
+	subscriptionPaused   subscriptionState = "paused"
+	subscriptionCanceled subscriptionState = "canceled"
+)
+
+type subscriptionEvent string
+
+const (
+	eventActivate subscriptionEvent = "activate"
+	eventPause    subscriptionEvent = "pause"
+	eventResume   subscriptionEvent = "resume"
+	eventCancel   subscriptionEvent = "cancel"
+)
+
+var errCantPauseYearly = errors.New("yearly subscriptions can not be paused")
+
+type subscriptionLifecycle struct {
+	subscription subscription
+	machine      *fsm.Machine[subscriptionState, subscriptionEvent]
+}
+
+func newSubscriptionLifecycle(s subscription) (*subscriptionLifecycle, error) {
+	onlyMonthly := func() error {
+		if s.interval != "monthly" {
+			return errCantPauseYearly
+		}
+		return nil
+	}
+	machine, err := fsm.NewMachine(subscriptionTrialing,
+		fsm.Transition[subscriptionState, subscriptionEvent]{From: subscriptionTrialing, Event: eventActivate, To: subscriptionActive},
+		fsm.Transition[subscriptionState, subscriptionEvent]{From: subscriptionActive, Event: eventPause, To: subscriptionPaused, Guard: onlyMonthly},
+		fsm.Transition[subscriptionState, subscriptionEvent]{From: subscriptionPaused, Event: eventResume, To: subscriptionActive},
+		fsm.Transition[subscriptionState, subscriptionEvent]{From: subscriptionTrialing, Event: eventCancel, To: subscriptionCanceled},
+		fsm.Transition[subscriptionState, subscriptionEvent]{From: subscriptionActive, Event: eventCancel, To: subscriptionCanceled},
+		fsm.Transition[subscriptionState, subscriptionEvent]{From: subscriptionPaused, Event: eventCancel, To: subscriptionCanceled},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &subscriptionLifecycle{subscription: s, machine: machine}, nil
+}
+
+func (sl *subscriptionLifecycle) activate() error { return sl.machine.Fire(eventActivate) }
+func (sl *subscriptionLifecycle) pause() error    { return sl.machine.Fire(eventPause) }
+func (sl *subscriptionLifecycle) resume() error   { return sl.machine.Fire(eventResume) }
+func (sl *subscriptionLifecycle) cancel() error   { return sl.machine.Fire(eventCancel) }
+
+func (sl *subscriptionLifecycle) state() subscriptionState {
+	return sl.machine.Current()
+}
+
+// billable is true when the subscription must be charged this cycle.
+func (sl *subscriptionLifecycle) billable() bool {
+	return sl.machine.Is(subscriptionActive)
+}
@@ -164,7 +164,7 @@ func Solution() {
 	- Calculate the user's new balance by subtracting the cost of the new item from their balance. This is your second return value.
 */
 func chargeForLineItem[T lineItem](newItem T, oldItems []T, balance float64) ([]T, float64, error) {
-	newBalance := newItem.GetCost() - balance
+	newBalance := balance - newItem.GetCost()
 	if newBalance < 0.0 {
 		var oldItems []T
 		return oldItems, 0.0, errors.New("insufficient funds")
@@ -232,6 +232,8 @@ type NumbersWith64Bits interface {
 }
 
 // Using NumbersWith64Bits interface as a generic constraint:
+// NOTE: divideNumbers panics when an integer is divided by zero, the numeric
+// package has a Divide that covers every integer and float kind and returns an error instead.
 func divideNumbers[T NumbersWith64Bits](x, y T) T {
 	return x / y
 }
@@ -256,7 +258,7 @@ func SolutionInterfaceTypeList() {
 // The store interface represents a store that sells products.
 // It takes a type parameter P that represents the type of products the store sells.
 type store[P product] interface {
-	Sell(P)
+	Sell(P) error
 }
 
 type product interface {
@@ -297,8 +299,9 @@ type bookStore struct {
 }
 
 // Sell adds a book to the bookStore's inventory.
-func (bs *bookStore) Sell(b book) {
+func (bs *bookStore) Sell(b book) error {
 	bs.booksSold = append(bs.booksSold, b)
+	return nil
 }
 
 // The toyStore struct represents a store that sells toys.
@@ -307,16 +310,20 @@ type toyStore struct {
 }
 
 // Sell adds a toy to the toyStore's inventory.
-func (ts *toyStore) Sell(t toy) {
+func (ts *toyStore) Sell(t toy) error {
 	ts.toysSold = append(ts.toysSold, t)
+	return nil
 }
 
 // sellProducts takes a store and a slice of products and sells
-// each product one by one.
-func sellProducts[P product](s store[P], products []P) {
+// each product one by one, it stops at the first product that can not be sold.
+func sellProducts[P product](s store[P], products []P) error {
 	for _, p := range products {
-		s.Sell(p)
+		if err := s.Sell(p); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func main() {
@@ -325,7 +332,7 @@ func main() {
 	}
 
 	// By passing in "book" as a type parameter, we can use the sellProducts function to sell books in a bookStore
-	sellProducts[book](&bs, []book{
+	err := sellProducts[book](&bs, []book{
 		{
 			title:  "The Hobbit",
 			author: "J.R.R. Tolkien",
@@ -337,13 +344,16 @@ func main() {
 			price:  20.0,
 		},
 	})
+	if err != nil {
+		fmt.Println(err)
+	}
 	fmt.Println(bs.booksSold)
 
 	// We can then do the same for toys
 	ts := toyStore{
 		toysSold: []toy{},
 	}
-	sellProducts[toy](&ts, []toy{
+	err = sellProducts[toy](&ts, []toy{
 		{
 			name:  "Lego",
 			price: 10.0,
@@ -353,6 +363,9 @@ func main() {
 			price: 20.0,
 		},
 	})
+	if err != nil {
+		fmt.Println(err)
+	}
 	fmt.Println(ts.toysSold)
 }
 
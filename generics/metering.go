@@ -0,0 +1,176 @@
+package generics
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// --- Usage Metering ---
+/*
+
+	A oneTimeUsagePlan is priced by its numEmailsAllowed, but until now
+	nothing kept track of how many of those emails a customer actually sent.
+
+	The usageMeter records every email sent against the plan of a customer
+	(keyed by the plan's userEmail) and exposes the remaining allowance.
+
+	- When the usage reaches 80% and 100% of the allowance, a usageEvent
+	is emitted once per period through the onEvent callback.
+	- When the period is closed, every email above the allowance is billed
+	at the configured overage rate as an overageCharge, which is a lineItem
+	so it can be passed straight into chargeForLineItem.
+*/
+
+var (
+	errPlanNotMetered     = errors.New("no metered plan for customer")
+	errPlanAlreadyMetered = errors.New("customer already has a metered plan")
+	errInvalidOverageRate = errors.New("overage rate can not be negative")
+)
+
+// usageThresholds are the percentages of the allowance that emit a warning.
+var usageThresholds = []int{80, 100}
+
+type usageEvent struct {
+	userEmail string
+	threshold int // percentage of the allowance that was reached
+	used      int
+	allowed   int
+}
+
+func (ue usageEvent) String() string {
+	return fmt.Sprintf("%s reached %d%% of the plan (%d/%d emails)", ue.userEmail, ue.threshold, ue.used, ue.allowed)
+}
+
+type usageRecord struct {
+	plan    oneTimeUsagePlan
+	used    int
+	warned  map[int]bool // thresholds already emitted in the current period
+	periods int          // number of closed periods
+}
+
+type usageMeter struct {
+	mu          *sync.Mutex
+	overageRate float64
+	records     map[string]*usageRecord
+	onEvent     func(usageEvent)
+}
+
+func newUsageMeter(overageRate float64, onEvent func(usageEvent)) (usageMeter, error) {
+	if overageRate < 0 {
+		return usageMeter{}, errInvalidOverageRate
+	}
+	if onEvent == nil {
+		onEvent = func(usageEvent) {}
+	}
+	return usageMeter{
+		mu:          &sync.Mutex{},
+		overageRate: overageRate,
+		records:     map[string]*usageRecord{},
+		onEvent:     onEvent,
+	}, nil
+}
+
+// track starts metering the emails sent by the owner of the plan.
+func (um usageMeter) track(plan oneTimeUsagePlan) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if _, ok := um.records[plan.userEmail]; ok {
+		return errPlanAlreadyMetered
+	}
+	um.records[plan.userEmail] = &usageRecord{
+		plan:   plan,
+		warned: map[int]bool{},
+	}
+	return nil
+}
+
+// recordEmail counts one email sent by the customer against their plan.
+// Sending over the allowance is allowed, it is billed when the period closes.
+func (um usageMeter) recordEmail(userEmail string) error {
+	um.mu.Lock()
+	record, ok := um.records[userEmail]
+	if !ok {
+		um.mu.Unlock()
+		return errPlanNotMetered
+	}
+	record.used++
+	events := record.pendingEvents()
+	um.mu.Unlock()
+
+	// events are emitted outside of the lock so the callback can use the meter
+	for _, e := range events {
+		um.onEvent(e)
+	}
+	return nil
+}
+
+// remaining returns how many emails are left in the current period.
+func (um usageMeter) remaining(userEmail string) (int, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	record, ok := um.records[userEmail]
+	if !ok {
+		return 0, errPlanNotMetered
+	}
+	return max(record.plan.numEmailsAllowed-record.used, 0), nil
+}
+
+// closePeriod bills the overage of the current period and resets the usage.
+// The overageCharge has a zero cost when the customer stayed within the plan.
+func (um usageMeter) closePeriod(userEmail string) (overageCharge, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	record, ok := um.records[userEmail]
+	if !ok {
+		return overageCharge{}, errPlanNotMetered
+	}
+	record.periods++
+	charge := overageCharge{
+		userEmail:     userEmail,
+		period:        record.periods,
+		overageEmails: max(record.used-record.plan.numEmailsAllowed, 0),
+		rate:          um.overageRate,
+	}
+	record.used = 0
+	record.warned = map[int]bool{}
+	return charge, nil
+}
+
+func (ur *usageRecord) pendingEvents() []usageEvent {
+	var events []usageEvent
+	for _, threshold := range usageThresholds {
+		if ur.warned[threshold] || !ur.reached(threshold) {
+			continue
+		}
+		ur.warned[threshold] = true
+		events = append(events, usageEvent{
+			userEmail: ur.plan.userEmail,
+			threshold: threshold,
+			used:      ur.used,
+			allowed:   ur.plan.numEmailsAllowed,
+		})
+	}
+	return events
+}
+
+// reached compares with integers so 80% of 5 emails is reached on the 4th email.
+func (ur *usageRecord) reached(threshold int) bool {
+	return ur.used*100 >= ur.plan.numEmailsAllowed*threshold
+}
+
+// overageCharge implements the lineItem interface.
+type overageCharge struct {
+	userEmail     string
+	period        int
+	overageEmails int
+	rate          float64
+}
+
+func (oc overageCharge) GetName() string {
+	return fmt.Sprintf("overage of %v emails for period %v", oc.overageEmails, oc.period)
+}
+
+func (oc overageCharge) GetCost() float64 {
+	return float64(oc.overageEmails) * oc.rate
+}
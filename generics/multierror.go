@@ -0,0 +1,267 @@
+package generics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// --- Multi-Errors ---
+/*
+
+	extractErrorsValues turns a slice of errors into strings, so we lose
+	their types and we can't use errors.Is or errors.As anymore.
+
+	When we send a batch we want to keep every error of the batch together
+	with the index of the item that failed. multiError does that:
+
+	- It implements Unwrap() []error, so errors.Is and errors.As look into
+	every error of the batch, just like an error built with errors.Join.
+	- It groups the errors by type or by code (errors with a Code() method)
+	and counts them.
+	- It can be serialized to JSON for our API responses.
+*/
+
+// itemError is the error of one item of a batch.
+type itemError struct {
+	index int
+	err   error
+}
+
+func (ie itemError) Error() string {
+	return fmt.Sprintf("item %d: %v", ie.index, ie.err)
+}
+
+func (ie itemError) Unwrap() error {
+	return ie.err
+}
+
+// coder is implemented by errors that carry a machine-readable code.
+type coder interface {
+	Code() string
+}
+
+type multiError struct {
+	errs []itemError
+}
+
+// collectErrors calls fn for every item and keeps the errors with the index of their item.
+func collectErrors[T any](items []T, fn func(T) error) *multiError {
+	me := &multiError{}
+	for i, item := range items {
+		me.add(i, fn(item))
+	}
+	return me
+}
+
+// collectErrorValues is the typed version of extractErrorsValues: nil errors are skipped
+// and every error keeps its type and its index in the slice.
+func collectErrorValues[T errorManager](sliceOfErrors []T) *multiError {
+	me := &multiError{}
+	for i, value := range sliceOfErrors {
+		if isNilError(value) {
+			continue
+		}
+		me.add(i, value)
+	}
+	return me
+}
+
+// add keeps the error of the item at index, nil errors are ignored.
+func (me *multiError) add(index int, err error) {
+	if err == nil {
+		return
+	}
+	me.errs = append(me.errs, itemError{index: index, err: err})
+}
+
+func (me *multiError) len() int {
+	return len(me.errs)
+}
+
+// err returns nil when there are no errors.
+// Returning a nil *multiError as an error would make it non-nil, that's why this method exists.
+func (me *multiError) err() error {
+	if me == nil || len(me.errs) == 0 {
+		return nil
+	}
+	return me
+}
+
+func (me *multiError) Error() string {
+	msgs := make([]string, 0, len(me.errs))
+	for _, ie := range me.errs {
+		msgs = append(msgs, ie.Error())
+	}
+	return fmt.Sprintf("%d errors: %s", len(me.errs), strings.Join(msgs, "; "))
+}
+
+// Unwrap lets errors.Is and errors.As look into every error of the batch.
+func (me *multiError) Unwrap() []error {
+	errs := make([]error, 0, len(me.errs))
+	for _, ie := range me.errs {
+		errs = append(errs, ie)
+	}
+	return errs
+}
+
+// join returns the errors of the batch as a single errors.Join error.
+func (me *multiError) join() error {
+	return errors.Join(me.Unwrap()...)
+}
+
+// failedIndexes returns the indexes of the items that failed.
+func (me *multiError) failedIndexes() []int {
+	indexes := make([]int, 0, len(me.errs))
+	for _, ie := range me.errs {
+		indexes = append(indexes, ie.index)
+	}
+	return indexes
+}
+
+type errorGroup struct {
+	Key     string `json:"key"`
+	Count   int    `json:"count"`
+	Indexes []int  `json:"indexes"`
+}
+
+// groupByType groups the errors by the type of their root cause.
+// Errors built with errors.Join are split in the errors they join.
+func (me *multiError) groupByType() []errorGroup {
+	return me.group(errorType)
+}
+
+// groupByCode groups the errors by their Code(), errors without a code are grouped under "unknown".
+func (me *multiError) groupByCode() []errorGroup {
+	return me.group(errorCode)
+}
+
+func (me *multiError) group(key func(error) string) []errorGroup {
+	groups := map[string]*errorGroup{}
+	for _, ie := range me.errs {
+		for _, err := range flattenErrors(ie.err) {
+			k := key(err)
+			g, ok := groups[k]
+			if !ok {
+				g = &errorGroup{Key: k}
+				groups[k] = g
+			}
+			g.Count++
+			if len(g.Indexes) == 0 || g.Indexes[len(g.Indexes)-1] != ie.index {
+				g.Indexes = append(g.Indexes, ie.index)
+			}
+		}
+	}
+	result := make([]errorGroup, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+type itemErrorJSON struct {
+	Index   int    `json:"index"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// MarshalJSON works on a nil *multiError too, it marshals a batch without errors.
+func (me *multiError) MarshalJSON() ([]byte, error) {
+	if me == nil {
+		me = &multiError{}
+	}
+	items := make([]itemErrorJSON, 0, len(me.errs))
+	for _, ie := range me.errs {
+		code := errorCode(ie.err)
+		if code == unknownErrorCode {
+			code = ""
+		}
+		// like by_type, a joined error has the types of the errors it joins
+		var types []string
+		for _, err := range flattenErrors(ie.err) {
+			if t := errorType(err); !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+		items = append(items, itemErrorJSON{
+			Index:   ie.index,
+			Type:    strings.Join(types, ", "),
+			Code:    code,
+			Message: ie.err.Error(),
+		})
+	}
+	return json.Marshal(struct {
+		Count  int             `json:"count"`
+		Errors []itemErrorJSON `json:"errors"`
+		ByType []errorGroup    `json:"by_type"`
+		ByCode []errorGroup    `json:"by_code"`
+	}{
+		Count:  len(me.errs),
+		Errors: items,
+		ByType: me.groupByType(),
+		ByCode: me.groupByCode(),
+	})
+}
+
+const unknownErrorCode = "unknown"
+
+func errorCode(err error) string {
+	var c coder
+	if errors.As(err, &c) {
+		return c.Code()
+	}
+	return unknownErrorCode
+}
+
+// errorType is the type of the root cause of err, the key of groupByType.
+func errorType(err error) string {
+	return fmt.Sprintf("%T", rootCause(err))
+}
+
+// rootCause follows the chain of wrapped errors down to the first error.
+func rootCause(err error) error {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return err
+		}
+		err = next
+	}
+}
+
+// flattenErrors splits the errors joined with errors.Join (or any Unwrap() []error).
+func flattenErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
+
+// isNilError is true for nil errors and for nil pointers stored in an error interface.
+func isNilError[T errorManager](value T) bool {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,447 @@
+package generics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Pricing Rules ---
+/*
+
+	Prices are hard-coded all over the place: subscription.GetCost,
+	userBiller, orgBiller, book and toy. The pricingEngine takes those
+	base prices and applies an ordered list of pricing rules on top of them.
+
+	A cart can be built from any slice of lineItems or products thanks to
+	the generic cartFromLineItems and cartFromProducts functions.
+
+	Rules are applied in order and each one sees the prices left by the
+	previous rules:
+
+	- percentDiscount: takes a percentage off every line (or a single line).
+	- fixedDiscount: takes a fixed amount off the whole cart.
+	- volumeTier: changes the unit price of a line depending on its quantity.
+	- bundle: sells a group of lines together for a fixed price.
+	- coupon: wraps any rule and only applies it when its code is used,
+	it can have a usage limit and an expiry date.
+
+	The result is a priceBreakdown that explains every adjustment.
+*/
+
+var (
+	errUnknownCoupon   = errors.New("unknown coupon code")
+	errCouponExpired   = errors.New("coupon expired")
+	errCouponExhausted = errors.New("coupon usage limit reached")
+	errDuplicateCoupon = errors.New("coupon code already registered")
+)
+
+type cartLine struct {
+	name      string
+	unitPrice float64
+	quantity  int
+}
+
+func (cl cartLine) subtotal() float64 {
+	return cl.unitPrice * float64(cl.quantity)
+}
+
+type cart struct {
+	lines []cartLine
+}
+
+// cartFromLineItems groups the line items by name.
+func cartFromLineItems[T lineItem](items []T) cart {
+	lines := make([]cartLine, 0, len(items))
+	for _, item := range items {
+		lines = addToCart(lines, item.GetName(), item.GetCost())
+	}
+	return cart{lines: lines}
+}
+
+// cartFromProducts groups the products by name.
+func cartFromProducts[P product](products []P) cart {
+	lines := make([]cartLine, 0, len(products))
+	for _, p := range products {
+		lines = addToCart(lines, p.Name(), p.Price())
+	}
+	return cart{lines: lines}
+}
+
+func addToCart(lines []cartLine, name string, unitPrice float64) []cartLine {
+	for i := range lines {
+		if lines[i].name == name && lines[i].unitPrice == unitPrice {
+			lines[i].quantity++
+			return lines
+		}
+	}
+	return append(lines, cartLine{name: name, unitPrice: unitPrice, quantity: 1})
+}
+
+// adjustment is a single change made by a rule, discounts have a negative amount.
+type adjustment struct {
+	rule        string
+	line        string // empty when the adjustment applies to the whole cart
+	description string
+	amount      float64
+}
+
+type priceBreakdown struct {
+	lines       []cartLine
+	subtotal    float64
+	adjustments []adjustment
+	total       float64
+}
+
+func (pb priceBreakdown) String() string {
+	var sb strings.Builder
+	for _, line := range pb.lines {
+		fmt.Fprintf(&sb, "%-40s %3d x %8.2f = %9.2f\n", line.name, line.quantity, line.unitPrice, line.subtotal())
+	}
+	fmt.Fprintf(&sb, "%-55s %9.2f\n", "subtotal", pb.subtotal)
+	for _, adj := range pb.adjustments {
+		fmt.Fprintf(&sb, "%-55s %9.2f\n", adj.description, adj.amount)
+	}
+	fmt.Fprintf(&sb, "%-55s %9.2f\n", "total", pb.total)
+	return sb.String()
+}
+
+// pricingState keeps the running amount of every line while the rules are applied.
+// amounts are indexed like lines, a product sold at two prices has two lines.
+type pricingState struct {
+	lines   []cartLine
+	amounts []float64
+	cartAdj float64 // cart-level adjustments
+}
+
+func (ps *pricingState) total() float64 {
+	total := ps.cartAdj
+	for _, amount := range ps.amounts {
+		total += amount
+	}
+	return total
+}
+
+// named returns the indexes of the lines of a product.
+func (ps *pricingState) named(name string) []int {
+	var indexes []int
+	for i, line := range ps.lines {
+		if line.name == name {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func (ps *pricingState) quantity(indexes []int) int {
+	quantity := 0
+	for _, i := range indexes {
+		quantity += ps.lines[i].quantity
+	}
+	return quantity
+}
+
+func (ps *pricingState) amount(indexes []int) float64 {
+	amount := 0.0
+	for _, i := range indexes {
+		amount += ps.amounts[i]
+	}
+	return amount
+}
+
+// spread adds amount to the lines in proportion to their running amounts,
+// the rounding difference goes to the last line.
+func (ps *pricingState) spread(indexes []int, amount float64) {
+	total := ps.amount(indexes)
+	left := amount
+	for n, i := range indexes {
+		share := left
+		if n < len(indexes)-1 && total != 0 {
+			share = roundCents(amount * ps.amounts[i] / total)
+		}
+		ps.amounts[i] += share
+		left = roundCents(left - share)
+	}
+}
+
+type pricingRule interface {
+	ruleName() string
+	apply(state *pricingState) []adjustment
+}
+
+type percentDiscount struct {
+	name    string
+	percent float64
+	line    string // empty to discount every line
+}
+
+func (pd percentDiscount) ruleName() string {
+	return pd.name
+}
+
+func (pd percentDiscount) apply(state *pricingState) []adjustment {
+	var adjustments []adjustment
+	for i, line := range state.lines {
+		if pd.line != "" && pd.line != line.name {
+			continue
+		}
+		amount := -roundCents(state.amounts[i] * pd.percent / 100)
+		if amount == 0 {
+			continue
+		}
+		state.amounts[i] += amount
+		adjustments = append(adjustments, adjustment{
+			rule:        pd.name,
+			line:        line.name,
+			description: fmt.Sprintf("%s: %.0f%% off %s", pd.name, pd.percent, line.name),
+			amount:      amount,
+		})
+	}
+	return adjustments
+}
+
+type fixedDiscount struct {
+	name   string
+	amount float64
+}
+
+func (fd fixedDiscount) ruleName() string {
+	return fd.name
+}
+
+func (fd fixedDiscount) apply(state *pricingState) []adjustment {
+	// a discount can not make the cart cheaper than free
+	amount := -math.Min(fd.amount, math.Max(state.total(), 0))
+	if amount == 0 {
+		return nil
+	}
+	state.cartAdj += amount
+	return []adjustment{{
+		rule:        fd.name,
+		description: fmt.Sprintf("%s: %.2f off", fd.name, fd.amount),
+		amount:      amount,
+	}}
+}
+
+type priceTier struct {
+	minQuantity int
+	unitPrice   float64
+}
+
+type volumeTier struct {
+	name  string
+	line  string
+	tiers []priceTier
+}
+
+func (vt volumeTier) ruleName() string {
+	return vt.name
+}
+
+// apply picks the tier from the quantity of the product and changes the running amount
+// of its lines in the ratio between the tier price and their unit price, so the
+// discounts applied before are kept.
+func (vt volumeTier) apply(state *pricingState) []adjustment {
+	indexes := state.named(vt.line)
+	if len(indexes) == 0 {
+		return nil
+	}
+	quantity := state.quantity(indexes)
+	tiers := append([]priceTier(nil), vt.tiers...)
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].minQuantity > tiers[j].minQuantity
+	})
+	for _, tier := range tiers {
+		if quantity < tier.minQuantity {
+			continue
+		}
+		amount := 0.0
+		for _, i := range indexes {
+			if state.lines[i].unitPrice == 0 {
+				continue
+			}
+			change := roundCents(state.amounts[i]*tier.unitPrice/state.lines[i].unitPrice - state.amounts[i])
+			state.amounts[i] += change
+			amount += change
+		}
+		amount = roundCents(amount)
+		if amount == 0 {
+			return nil
+		}
+		return []adjustment{{
+			rule:        vt.name,
+			line:        vt.line,
+			description: fmt.Sprintf("%s: %d+ units of %s at %.2f", vt.name, tier.minQuantity, vt.line, tier.unitPrice),
+			amount:      amount,
+		}}
+	}
+	return nil
+}
+
+type bundle struct {
+	name  string
+	items []string
+	price float64
+}
+
+func (b bundle) ruleName() string {
+	return b.name
+}
+
+func (b bundle) apply(state *pricingState) []adjustment {
+	if len(b.items) == 0 {
+		return nil
+	}
+	// the number of complete bundles is limited by the scarcest item,
+	// the items are priced at their running unit price
+	sets := math.MaxInt
+	listPrice := 0.0
+	unitPrices := make([]float64, len(b.items))
+	for n, item := range b.items {
+		indexes := state.named(item)
+		quantity := state.quantity(indexes)
+		if quantity == 0 {
+			return nil
+		}
+		sets = min(sets, quantity)
+		unitPrices[n] = state.amount(indexes) / float64(quantity)
+		listPrice += unitPrices[n]
+	}
+	amount := roundCents((b.price - listPrice) * float64(sets))
+	if amount >= 0 {
+		return nil
+	}
+	// the saving comes off the items of the bundle, so the next rules see it
+	left := amount
+	for n, item := range b.items {
+		share := left
+		if n < len(b.items)-1 {
+			share = roundCents(amount * unitPrices[n] / listPrice)
+		}
+		state.spread(state.named(item), share)
+		left = roundCents(left - share)
+	}
+	return []adjustment{{
+		rule:        b.name,
+		description: fmt.Sprintf("%s: %d x bundle of %s for %.2f", b.name, sets, strings.Join(b.items, " + "), b.price),
+		amount:      amount,
+	}}
+}
+
+type coupon struct {
+	code      string
+	rule      pricingRule
+	maxUses   int // zero means unlimited
+	used      int
+	expiresAt time.Time // zero means it never expires
+}
+
+func (c *coupon) validate(at time.Time) error {
+	if !c.expiresAt.IsZero() && !at.Before(c.expiresAt) {
+		return errCouponExpired
+	}
+	if c.maxUses > 0 && c.used >= c.maxUses {
+		return errCouponExhausted
+	}
+	return nil
+}
+
+type pricingEngine struct {
+	mu      *sync.Mutex
+	rules   []pricingRule
+	coupons map[string]*coupon
+	order   []string // coupon codes in registration order
+}
+
+func newPricingEngine(rules ...pricingRule) *pricingEngine {
+	return &pricingEngine{
+		mu:      &sync.Mutex{},
+		rules:   rules,
+		coupons: map[string]*coupon{},
+	}
+}
+
+// addCoupon registers a coupon, coupons are applied after the rules in the order they were added.
+func (pe *pricingEngine) addCoupon(code string, rule pricingRule, maxUses int, expiresAt time.Time) error {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	code = strings.ToUpper(code)
+	if _, ok := pe.coupons[code]; ok {
+		return errDuplicateCoupon
+	}
+	pe.coupons[code] = &coupon{
+		code:      code,
+		rule:      rule,
+		maxUses:   maxUses,
+		expiresAt: expiresAt,
+	}
+	pe.order = append(pe.order, code)
+	return nil
+}
+
+// quote prices the cart without counting a use of the coupons.
+func (pe *pricingEngine) quote(c cart, at time.Time, codes ...string) (priceBreakdown, error) {
+	return pe.price(c, at, false, codes)
+}
+
+// checkout prices the cart and counts one use of every coupon code.
+func (pe *pricingEngine) checkout(c cart, at time.Time, codes ...string) (priceBreakdown, error) {
+	return pe.price(c, at, true, codes)
+}
+
+func (pe *pricingEngine) price(c cart, at time.Time, redeem bool, codes []string) (priceBreakdown, error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	requested := map[string]bool{}
+	for _, code := range codes {
+		code = strings.ToUpper(code)
+		cp, ok := pe.coupons[code]
+		if !ok {
+			return priceBreakdown{}, fmt.Errorf("%w: %s", errUnknownCoupon, code)
+		}
+		if err := cp.validate(at); err != nil {
+			return priceBreakdown{}, fmt.Errorf("%w: %s", err, code)
+		}
+		requested[code] = true
+	}
+
+	state := &pricingState{
+		lines:   c.lines,
+		amounts: make([]float64, len(c.lines)),
+	}
+	breakdown := priceBreakdown{lines: c.lines}
+	for i, line := range c.lines {
+		state.amounts[i] = line.subtotal()
+		breakdown.subtotal += line.subtotal()
+	}
+
+	for _, rule := range pe.rules {
+		breakdown.adjustments = append(breakdown.adjustments, rule.apply(state)...)
+	}
+	for _, code := range pe.order {
+		if !requested[code] {
+			continue
+		}
+		cp := pe.coupons[code]
+		adjustments := cp.rule.apply(state)
+		for i := range adjustments {
+			adjustments[i].description = fmt.Sprintf("coupon %s - %s", code, adjustments[i].description)
+		}
+		breakdown.adjustments = append(breakdown.adjustments, adjustments...)
+		if redeem {
+			cp.used++
+		}
+	}
+
+	breakdown.total = roundCents(state.total())
+	return breakdown, nil
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,308 @@
+package generics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daniela2001-png/freecodecamp_go_course/payments"
+)
+
+// --- Refunds and Credit Notes ---
+/*
+
+	Once a bill or a lineItem was charged there was no way back.
+	The billingLedger keeps every charge so it can be refunded, fully or
+	partially. Every refund generates a creditNote linked to the charge.
+
+	A refund can go to:
+
+	- refundToCredit: the customer's credit balance. The credit is applied
+	automatically to the next invoice of the customer.
+	- refundToPaymentMethod: the payment method that was charged, through
+	the payments.PaymentGateway. Only charges made through the gateway can
+	be refunded this way.
+
+	A charge can never be refunded more than what was charged.
+
+	The caller passes ONE idempotency key per refund, like chargeWithGateway.
+	Retrying a refund that timed out with the same key sends the same key to
+	the processor, so the customer is never paid twice. While the gateway
+	call is running the amount is reserved on the charge and the ledger is
+	NOT locked: the network never blocks the other customers.
+*/
+
+type refundDestination string
+
+const (
+	refundToCredit        refundDestination = "credit"
+	refundToPaymentMethod refundDestination = "payment method"
+)
+
+var (
+	errChargeNotFound           = errors.New("charge not found")
+	errRefundExceedsCharge      = errors.New("refund exceeds the amount left to refund")
+	errInvalidRefundAmount      = errors.New("refund amount must be greater than zero")
+	errNoGatewayForRefund       = errors.New("charge was not made through a payment gateway")
+	errUnknownRefundDestination = errors.New("unknown refund destination")
+	errMissingRefundKey         = errors.New("a refund needs an idempotency key")
+	errRefundKeyReused          = errors.New("refund idempotency key reused with a different refund")
+	errRefundInProgress         = errors.New("a refund with this idempotency key is in progress")
+)
+
+type chargeRecord struct {
+	id            string
+	customerEmail string
+	description   string
+	amount        float64
+	refunded      float64
+	reserved      float64 // refunds waiting for the payment gateway
+	captureID     string  // set when the charge was captured by a payment gateway
+	chargedAt     time.Time
+}
+
+func (cr chargeRecord) refundable() float64 {
+	return roundCents(cr.amount - cr.refunded - cr.reserved)
+}
+
+type creditNote struct {
+	id            string
+	chargeID      string
+	customerEmail string
+	amount        float64
+	reason        string
+	destination   refundDestination
+	issuedAt      time.Time
+}
+
+// invoice is a bill after the credit balance of the customer was applied.
+type invoice struct {
+	id            string
+	bill          bill
+	creditApplied float64
+	amountDue     float64
+	chargeID      string // charge of the amountDue, empty when the credit paid everything
+	issuedAt      time.Time
+}
+
+// refundAttempt is a refund by its idempotency key. An attempt whose gateway call
+// failed without an answer stays reserved until it is retried with the same key.
+type refundAttempt struct {
+	chargeID    string
+	amount      float64
+	destination refundDestination
+	inFlight    bool
+	note        *creditNote // set once the refund is done
+}
+
+type billingLedger struct {
+	mu          *sync.Mutex
+	gateway     payments.PaymentGateway // can be nil when refunds only go to credit
+	charges     map[string]*chargeRecord
+	creditNotes []creditNote
+	credits     map[string]float64
+	invoices    []invoice
+	refunds     map[string]*refundAttempt // by idempotency key
+	nextID      int
+}
+
+func newBillingLedger(gateway payments.PaymentGateway) *billingLedger {
+	return &billingLedger{
+		mu:      &sync.Mutex{},
+		gateway: gateway,
+		charges: map[string]*chargeRecord{},
+		credits: map[string]float64{},
+		refunds: map[string]*refundAttempt{},
+	}
+}
+
+// recordCharge keeps a lineItem that was charged to a customer.
+func (bl *billingLedger) recordCharge(c customer, item lineItem, at time.Time) chargeRecord {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	return bl.addCharge(c.GetBillingEmail(), item.GetName(), item.GetCost(), "", at)
+}
+
+// recordGatewayCharge keeps a lineItem charged with chargeWithGateway,
+// so it can be refunded to the payment method.
+func (bl *billingLedger) recordGatewayCharge(c customer, item lineItem, capture payments.Transaction) chargeRecord {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	return bl.addCharge(c.GetBillingEmail(), item.GetName(), capture.Amount, capture.ID, capture.CreatedAt)
+}
+
+// issueInvoice applies the credit balance of the customer to the bill
+// and records the charge of what is left to pay.
+func (bl *billingLedger) issueInvoice(b bill, at time.Time) invoice {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	email := b.Customer.GetBillingEmail()
+	credit := min(bl.credits[email], b.Amount)
+	bl.credits[email] = roundCents(bl.credits[email] - credit)
+
+	bl.nextID++
+	inv := invoice{
+		id:            fmt.Sprintf("inv-%d", bl.nextID),
+		bill:          b,
+		creditApplied: credit,
+		amountDue:     roundCents(b.Amount - credit),
+		issuedAt:      at,
+	}
+	if inv.amountDue > 0 {
+		inv.chargeID = bl.addCharge(email, "invoice "+inv.id, inv.amountDue, "", at).id
+	}
+	bl.invoices = append(bl.invoices, inv)
+	return inv
+}
+
+// refund gives back part of a charge and issues the credit note of the refund.
+// Calling it again with the same idempotencyKey returns the same credit note.
+func (bl *billingLedger) refund(ctx context.Context, chargeID string, amount float64, destination refundDestination, reason, idempotencyKey string, at time.Time) (creditNote, error) {
+	if idempotencyKey == "" {
+		return creditNote{}, errMissingRefundKey
+	}
+	if amount <= 0 {
+		return creditNote{}, errInvalidRefundAmount
+	}
+	amount = roundCents(amount)
+	if destination != refundToCredit && destination != refundToPaymentMethod {
+		return creditNote{}, errUnknownRefundDestination
+	}
+
+	bl.mu.Lock()
+	charge, ok := bl.charges[chargeID]
+	if !ok {
+		bl.mu.Unlock()
+		return creditNote{}, fmt.Errorf("%w: %s", errChargeNotFound, chargeID)
+	}
+	attempt, retry := bl.refunds[idempotencyKey]
+	switch {
+	case retry && (attempt.chargeID != chargeID || attempt.amount != amount || attempt.destination != destination):
+		bl.mu.Unlock()
+		return creditNote{}, errRefundKeyReused
+	case retry && attempt.note != nil:
+		bl.mu.Unlock()
+		return *attempt.note, nil
+	case retry && attempt.inFlight:
+		bl.mu.Unlock()
+		return creditNote{}, errRefundInProgress
+	case !retry:
+		if amount > charge.refundable() {
+			bl.mu.Unlock()
+			return creditNote{}, fmt.Errorf("%w: %.2f requested, %.2f left on %s", errRefundExceedsCharge, amount, charge.refundable(), chargeID)
+		}
+		if destination == refundToPaymentMethod && (bl.gateway == nil || charge.captureID == "") {
+			bl.mu.Unlock()
+			return creditNote{}, errNoGatewayForRefund
+		}
+		attempt = &refundAttempt{chargeID: chargeID, amount: amount, destination: destination}
+		bl.refunds[idempotencyKey] = attempt
+		charge.reserved = roundCents(charge.reserved + amount)
+	}
+
+	if destination == refundToCredit {
+		bl.credits[charge.customerEmail] = roundCents(bl.credits[charge.customerEmail] + amount)
+		note := bl.completeRefund(charge, attempt, reason, at)
+		bl.mu.Unlock()
+		return note, nil
+	}
+
+	attempt.inFlight = true
+	captureID := charge.captureID
+	bl.mu.Unlock()
+
+	_, err := bl.gateway.Refund(ctx, payments.RefundRequest{
+		IdempotencyKey: idempotencyKey,
+		CaptureID:      captureID,
+		Amount:         amount,
+	})
+
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	attempt.inFlight = false
+	if err != nil {
+		// without an answer the refund may have been paid, keep the amount
+		// reserved until the caller retries with the same key
+		if !errors.Is(err, payments.ErrTimeout) && !errors.Is(err, payments.ErrUnavailable) && ctx.Err() == nil {
+			charge.reserved = roundCents(charge.reserved - amount)
+			delete(bl.refunds, idempotencyKey)
+		}
+		return creditNote{}, err
+	}
+	return bl.completeRefund(charge, attempt, reason, at), nil
+}
+
+// completeRefund must be called with the mutex locked, it moves the reserved amount to refunded.
+func (bl *billingLedger) completeRefund(charge *chargeRecord, attempt *refundAttempt, reason string, at time.Time) creditNote {
+	bl.nextID++
+	note := creditNote{
+		id:            fmt.Sprintf("cn-%d", bl.nextID),
+		chargeID:      charge.id,
+		customerEmail: charge.customerEmail,
+		amount:        attempt.amount,
+		reason:        reason,
+		destination:   attempt.destination,
+		issuedAt:      at,
+	}
+	charge.reserved = roundCents(charge.reserved - attempt.amount)
+	charge.refunded = roundCents(charge.refunded + attempt.amount)
+	bl.creditNotes = append(bl.creditNotes, note)
+	attempt.note = &note
+	return note
+}
+
+// refundFull gives back everything that is left to refund on a charge.
+func (bl *billingLedger) refundFull(ctx context.Context, chargeID string, destination refundDestination, reason, idempotencyKey string, at time.Time) (creditNote, error) {
+	bl.mu.Lock()
+	attempt, retry := bl.refunds[idempotencyKey]
+	charge, ok := bl.charges[chargeID]
+	var amount float64
+	switch {
+	case retry && attempt.chargeID == chargeID:
+		// a retry refunds what the first call asked for
+		amount = attempt.amount
+	case ok:
+		amount = charge.refundable()
+	}
+	bl.mu.Unlock()
+	if !ok {
+		return creditNote{}, fmt.Errorf("%w: %s", errChargeNotFound, chargeID)
+	}
+	return bl.refund(ctx, chargeID, amount, destination, reason, idempotencyKey, at)
+}
+
+func (bl *billingLedger) creditBalance(email string) float64 {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	return bl.credits[email]
+}
+
+// creditNotesFor returns the credit notes issued against a charge.
+func (bl *billingLedger) creditNotesFor(chargeID string) []creditNote {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	var notes []creditNote
+	for _, note := range bl.creditNotes {
+		if note.chargeID == chargeID {
+			notes = append(notes, note)
+		}
+	}
+	return notes
+}
+
+// addCharge must be called with the mutex locked.
+func (bl *billingLedger) addCharge(email, description string, amount float64, captureID string, at time.Time) chargeRecord {
+	bl.nextID++
+	charge := &chargeRecord{
+		id:            fmt.Sprintf("ch-%d", bl.nextID),
+		customerEmail: email,
+		description:   description,
+		amount:        roundCents(amount),
+		captureID:     captureID,
+		chargedAt:     at,
+	}
+	bl.charges[charge.id] = charge
+	return *charge
+}
@@ -0,0 +1,283 @@
+package generics
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- Revenue Recognition ---
+/*
+
+	A yearly subscription is charged 250.00 up front, but Mailio only
+	earns that money while it provides the service: 1/12 every month.
+	Money that was charged but not earned yet is "deferred revenue".
+
+	The recognitionEngine turns every charge into a schedule with the
+	revenue recognized each month:
+
+	- upgrade: a mid-period upgrade charges more money, that money is
+	recognized over the months left in the period.
+	- refund: a refund takes money out of the months that were not
+	recognized yet. When the refund is bigger than what is left, the
+	difference is reversed in the month of the refund.
+
+	monthlyRevenue builds the report finance needs: for every month, the
+	revenue recognized and the deferred revenue at the end of the month.
+	writeRevenueCSV exports it as CSV.
+*/
+
+var (
+	errScheduleNotFound     = errors.New("recognition schedule not found")
+	errScheduleExists       = errors.New("recognition schedule already exists")
+	errUnknownInterval      = errors.New("unknown subscription interval")
+	errInvalidRevenueAmount = errors.New("amount must be greater than zero")
+	errRefundExceedsBilled  = errors.New("refund is bigger than what was billed")
+)
+
+// calendarMonth is the key of the recognized revenue. time.Time keys compare
+// the location too, a month must be the same month in every location.
+type calendarMonth struct {
+	year  int
+	month time.Month
+}
+
+func monthOf(t time.Time) calendarMonth {
+	return calendarMonth{year: t.Year(), month: t.Month()}
+}
+
+func (cm calendarMonth) add(months int) calendarMonth {
+	return monthOf(time.Date(cm.year, cm.month+time.Month(months), 1, 0, 0, 0, 0, time.UTC))
+}
+
+func (cm calendarMonth) before(other calendarMonth) bool {
+	return cm.year < other.year || cm.year == other.year && cm.month < other.month
+}
+
+func (cm calendarMonth) String() string {
+	return fmt.Sprintf("%04d-%02d", cm.year, cm.month)
+}
+
+type billingEvent struct {
+	at     time.Time
+	amount float64 // negative for refunds
+}
+
+type recognitionSchedule struct {
+	chargeID   string
+	start      calendarMonth // first month of service
+	months     int
+	recognized map[calendarMonth]float64
+	billings   []billingEvent
+}
+
+// end is the first month after the service.
+func (rs *recognitionSchedule) end() calendarMonth {
+	return rs.start.add(rs.months)
+}
+
+// spread recognizes an amount evenly over the months from `from` to the end of the schedule,
+// the rounding difference goes to the last month. An amount charged after the end is
+// recognized in the month it was charged, the months before are closed.
+func (rs *recognitionSchedule) spread(amount float64, from calendarMonth) {
+	if from.before(rs.start) {
+		from = rs.start
+	}
+	months := monthsBetween(from, rs.end())
+	if months <= 0 {
+		// the period is over, everything is recognized in the month of the charge
+		rs.recognized[from] += amount
+		return
+	}
+	perMonth := roundCents(amount / float64(months))
+	for i := 0; i < months; i++ {
+		month := from.add(i)
+		if i == months-1 {
+			perMonth = roundCents(amount - perMonth*float64(months-1))
+		}
+		rs.recognized[month] += perMonth
+	}
+}
+
+// refundable is what was billed minus what was refunded.
+func (rs *recognitionSchedule) refundable() float64 {
+	left := 0.0
+	for _, b := range rs.billings {
+		left += b.amount
+	}
+	return roundCents(left)
+}
+
+type recognitionEngine struct {
+	mu        *sync.Mutex
+	schedules map[string]*recognitionSchedule
+}
+
+func newRecognitionEngine() recognitionEngine {
+	return recognitionEngine{
+		mu:        &sync.Mutex{},
+		schedules: map[string]*recognitionSchedule{},
+	}
+}
+
+// recognizeSubscription creates the schedule of a subscription charge:
+// 12 months for a yearly subscription and 1 month for a monthly one.
+func (re recognitionEngine) recognizeSubscription(chargeID string, s subscription, amount float64) error {
+	months := 0
+	switch s.interval {
+	case "monthly":
+		months = 1
+	case "yearly":
+		months = 12
+	default:
+		return fmt.Errorf("%w: %s", errUnknownInterval, s.interval)
+	}
+	return re.recognize(chargeID, s.startDate, months, amount)
+}
+
+// recognize creates the schedule of a charge made at `start` for `months` of service.
+func (re recognitionEngine) recognize(chargeID string, start time.Time, months int, amount float64) error {
+	if amount <= 0 {
+		return errInvalidRevenueAmount
+	}
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	if _, ok := re.schedules[chargeID]; ok {
+		return errScheduleExists
+	}
+	rs := &recognitionSchedule{
+		chargeID:   chargeID,
+		start:      monthOf(start),
+		months:     months,
+		recognized: map[calendarMonth]float64{},
+		billings:   []billingEvent{{at: start, amount: amount}},
+	}
+	rs.spread(amount, rs.start)
+	re.schedules[chargeID] = rs
+	return nil
+}
+
+// upgrade adds the extra amount charged at `at` to the months left in the period.
+func (re recognitionEngine) upgrade(chargeID string, at time.Time, amount float64) error {
+	if amount <= 0 {
+		return errInvalidRevenueAmount
+	}
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	rs, ok := re.schedules[chargeID]
+	if !ok {
+		return errScheduleNotFound
+	}
+	rs.billings = append(rs.billings, billingEvent{at: at, amount: amount})
+	rs.spread(amount, monthOf(at))
+	return nil
+}
+
+// refund removes the refunded amount from the months that were not recognized yet,
+// the rounding difference goes to the last month, like spread does.
+func (re recognitionEngine) refund(chargeID string, at time.Time, amount float64) error {
+	if amount <= 0 {
+		return errInvalidRevenueAmount
+	}
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	rs, ok := re.schedules[chargeID]
+	if !ok {
+		return errScheduleNotFound
+	}
+	if left := rs.refundable(); roundCents(amount) > left {
+		return fmt.Errorf("%w: %.2f requested, %.2f left on %s", errRefundExceedsBilled, amount, left, chargeID)
+	}
+	rs.billings = append(rs.billings, billingEvent{at: at, amount: -amount})
+
+	// months from the month of the refund on are not recognized yet
+	refundMonth := monthOf(at)
+	var months []calendarMonth
+	deferred := 0.0
+	for month, revenue := range rs.recognized {
+		if !month.before(refundMonth) && revenue > 0 {
+			months = append(months, month)
+			deferred += revenue
+		}
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].before(months[j]) })
+	fromDeferred := roundCents(min(amount, deferred))
+	taken := 0.0
+	for i, month := range months {
+		cut := roundCents(rs.recognized[month] / deferred * fromDeferred)
+		if i == len(months)-1 {
+			cut = roundCents(fromDeferred - taken)
+		}
+		taken += cut
+		rs.recognized[month] = roundCents(rs.recognized[month] - cut)
+	}
+	if reversal := roundCents(amount - fromDeferred); reversal > 0 {
+		rs.recognized[refundMonth] -= reversal
+	}
+	return nil
+}
+
+type revenueMonth struct {
+	month      calendarMonth
+	recognized float64
+	deferred   float64 // deferred revenue at the end of the month
+}
+
+// monthlyRevenue returns the revenue of every month between from and to (both included).
+// Months are calendar months, whatever the location of from and to.
+func (re recognitionEngine) monthlyRevenue(from, to time.Time) []revenueMonth {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	var report []revenueMonth
+	last := monthOf(to)
+	for month := monthOf(from); !last.before(month); month = month.add(1) {
+		line := revenueMonth{month: month}
+		billed, recognizedToDate := 0.0, 0.0
+		for _, rs := range re.schedules {
+			line.recognized += rs.recognized[month]
+			for _, b := range rs.billings {
+				if !month.before(monthOf(b.at)) {
+					billed += b.amount
+				}
+			}
+			for m, revenue := range rs.recognized {
+				if !month.before(m) {
+					recognizedToDate += revenue
+				}
+			}
+		}
+		line.recognized = roundCents(line.recognized)
+		line.deferred = roundCents(billed - recognizedToDate)
+		report = append(report, line)
+	}
+	return report
+}
+
+// writeRevenueCSV exports the monthly revenue report as CSV.
+func (re recognitionEngine) writeRevenueCSV(w io.Writer, from, to time.Time) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"month", "recognized", "deferred"}); err != nil {
+		return err
+	}
+	for _, line := range re.monthlyRevenue(from, to) {
+		record := []string{
+			line.month.String(),
+			fmt.Sprintf("%.2f", line.recognized),
+			fmt.Sprintf("%.2f", line.deferred),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func monthsBetween(from, to calendarMonth) int {
+	return (to.year-from.year)*12 + int(to.month-from.month)
+}
@@ -0,0 +1,297 @@
+package generics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- Seat-Based Org Billing ---
+/*
+
+	An org used to pay a flat amount. With seat-based billing an org pays
+	for every member (seat) it has:
+
+	- Members have a role: admin, billing or member.
+	- Seats are billed in advance for the whole cycle.
+	- Adding a member in the middle of the cycle charges the part of the
+	seat that is left, removing one gives back the part that is left.
+	Those prorations are added to the next invoice. When the credits are
+	bigger than the invoice, the invoice is zero and what is left of the
+	credit goes to the invoice after it.
+	- Billing emails go to the billing contact of the org when it has one,
+	otherwise to the admin of the org.
+*/
+
+type orgRole string
+
+const (
+	roleAdmin   orgRole = "admin"
+	roleBilling orgRole = "billing"
+	roleMember  orgRole = "member"
+)
+
+var (
+	errMemberExists        = errors.New("user is already a member of the org")
+	errMemberNotFound      = errors.New("user is not a member of the org")
+	errCantRemoveAdmin     = errors.New("the admin of the org can not be removed")
+	errInvalidBillingCycle = errors.New("billing cycle must end after it starts")
+	errNoSeatAccount       = errors.New("org has no seat account")
+)
+
+type orgMember struct {
+	user     user
+	role     orgRole
+	joinedAt time.Time
+}
+
+type seatAdjustment struct {
+	description string
+	amount      float64 // negative when a seat is removed
+	at          time.Time
+}
+
+// billedOrg is the customer of a seat bill, it sends the bill to the billing contact.
+type billedOrg struct {
+	org
+	billingContact string
+}
+
+func (bo billedOrg) GetBillingEmail() string {
+	if bo.billingContact != "" {
+		return bo.billingContact
+	}
+	return bo.org.GetBillingEmail()
+}
+
+type seatInvoice struct {
+	bill        bill
+	seats       int
+	seatsAmount float64
+	adjustments []seatAdjustment
+	// carriedCredit is the credit bigger than the invoice, it goes to the next one
+	carriedCredit float64
+	cycleStart    time.Time
+	cycleEnd      time.Time
+}
+
+type seatAccount struct {
+	mu             *sync.Mutex
+	org            org
+	seatPrice      float64
+	members        map[string]orgMember
+	billingContact string
+	cycleStart     time.Time
+	cycleEnd       time.Time
+	pending        []seatAdjustment
+}
+
+// newSeatAccount creates the account of an org, its admin takes the first seat.
+func newSeatAccount(o org, seatPrice float64, cycleStart, cycleEnd time.Time) (*seatAccount, error) {
+	if !cycleEnd.After(cycleStart) {
+		return nil, errInvalidBillingCycle
+	}
+	return &seatAccount{
+		mu:        &sync.Mutex{},
+		org:       o,
+		seatPrice: seatPrice,
+		members: map[string]orgMember{
+			o.Admin.GetBillingEmail(): {user: o.Admin, role: roleAdmin, joinedAt: cycleStart},
+		},
+		cycleStart: cycleStart,
+		cycleEnd:   cycleEnd,
+	}, nil
+}
+
+// addMember gives a seat to the user and charges the part of the cycle that is left.
+func (sa *seatAccount) addMember(u user, role orgRole, at time.Time) error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	email := u.GetBillingEmail()
+	if _, ok := sa.members[email]; ok {
+		return errMemberExists
+	}
+	sa.members[email] = orgMember{user: u, role: role, joinedAt: at}
+	sa.pending = append(sa.pending, seatAdjustment{
+		description: fmt.Sprintf("seat added for %s on %s", email, at.Format(time.DateOnly)),
+		amount:      sa.prorate(at),
+		at:          at,
+	})
+	return nil
+}
+
+// removeMember frees the seat of the user and credits the part of the cycle that is left.
+func (sa *seatAccount) removeMember(email string, at time.Time) error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	member, ok := sa.members[email]
+	if !ok {
+		return errMemberNotFound
+	}
+	if member.user == sa.org.Admin {
+		return errCantRemoveAdmin
+	}
+	delete(sa.members, email)
+	if sa.billingContact == email {
+		sa.billingContact = ""
+	}
+	sa.pending = append(sa.pending, seatAdjustment{
+		description: fmt.Sprintf("seat removed for %s on %s", email, at.Format(time.DateOnly)),
+		amount:      -sa.prorate(at),
+		at:          at,
+	})
+	return nil
+}
+
+func (sa *seatAccount) changeRole(email string, role orgRole) error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	member, ok := sa.members[email]
+	if !ok {
+		return errMemberNotFound
+	}
+	member.role = role
+	sa.members[email] = member
+	return nil
+}
+
+// setBillingContact routes the billing emails to a member of the org,
+// an empty email routes them back to the admin.
+func (sa *seatAccount) setBillingContact(email string) error {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if email != "" {
+		if _, ok := sa.members[email]; !ok {
+			return errMemberNotFound
+		}
+	}
+	sa.billingContact = email
+	return nil
+}
+
+func (sa *seatAccount) seats() int {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return len(sa.members)
+}
+
+// previewInvoice returns the invoice of the next cycle without closing the current one.
+func (sa *seatAccount) previewInvoice(nextCycleEnd time.Time) seatInvoice {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return sa.invoice(nextCycleEnd)
+}
+
+// closeCycle issues the invoice of the next cycle: its seats billed in advance
+// plus the prorations of the cycle that ends.
+func (sa *seatAccount) closeCycle(nextCycleEnd time.Time) (seatInvoice, error) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if !nextCycleEnd.After(sa.cycleEnd) {
+		return seatInvoice{}, errInvalidBillingCycle
+	}
+	inv := sa.invoice(nextCycleEnd)
+	sa.pending = nil
+	if inv.carriedCredit > 0 {
+		sa.pending = append(sa.pending, seatAdjustment{
+			description: fmt.Sprintf("credit carried from the invoice of %s", sa.cycleEnd.Format(time.DateOnly)),
+			amount:      -inv.carriedCredit,
+			at:          sa.cycleEnd,
+		})
+	}
+	sa.cycleStart, sa.cycleEnd = sa.cycleEnd, nextCycleEnd
+	return inv, nil
+}
+
+// invoice must be called with the mutex locked.
+func (sa *seatAccount) invoice(nextCycleEnd time.Time) seatInvoice {
+	inv := seatInvoice{
+		seats:       len(sa.members),
+		seatsAmount: roundCents(float64(len(sa.members)) * sa.seatPrice),
+		adjustments: append([]seatAdjustment(nil), sa.pending...),
+		cycleStart:  sa.cycleEnd,
+		cycleEnd:    nextCycleEnd,
+	}
+	sort.Slice(inv.adjustments, func(i, j int) bool {
+		return inv.adjustments[i].at.Before(inv.adjustments[j].at)
+	})
+	amount := inv.seatsAmount
+	for _, adj := range inv.adjustments {
+		amount += adj.amount
+	}
+	amount = roundCents(amount)
+	if amount < 0 {
+		inv.carriedCredit = -amount
+		amount = 0
+	}
+	inv.bill = bill{
+		Customer: billedOrg{org: sa.org, billingContact: sa.billingContact},
+		Amount:   amount,
+	}
+	return inv
+}
+
+// prorate returns the price of a seat for the part of the cycle left after `at`.
+// It must be called with the mutex locked.
+func (sa *seatAccount) prorate(at time.Time) float64 {
+	if !at.Before(sa.cycleEnd) {
+		return 0.0
+	}
+	if at.Before(sa.cycleStart) {
+		at = sa.cycleStart
+	}
+	left := sa.cycleEnd.Sub(at).Hours()
+	total := sa.cycleEnd.Sub(sa.cycleStart).Hours()
+	return roundCents(sa.seatPrice * left / total)
+}
+
+// seatBiller keeps the seat accounts of the orgs. It is not a biller itself:
+// resolve returns the biller of one org, or an error when the org has no seat
+// account, instead of a silent empty bill (like resolveBiller does for plans).
+type seatBiller struct {
+	accounts     map[string]*seatAccount // by org name
+	nextCycleEnd func(cycleEnd time.Time) time.Time
+}
+
+func newSeatBiller(accounts ...*seatAccount) seatBiller {
+	sb := seatBiller{
+		accounts: map[string]*seatAccount{},
+		nextCycleEnd: func(cycleEnd time.Time) time.Time {
+			return cycleEnd.AddDate(0, 1, 0)
+		},
+	}
+	for _, account := range accounts {
+		sb.accounts[account.org.Name] = account
+	}
+	return sb
+}
+
+func (sb seatBiller) resolve(o org) (biller[org], error) {
+	account, ok := sb.accounts[o.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errNoSeatAccount, o.Name)
+	}
+	return seatAccountBiller{account: account, nextCycleEnd: sb.nextCycleEnd}, nil
+}
+
+// seatAccountBiller implements the biller interface for the org of one seat account.
+// Charge bills o with the invoice its account would get if the cycle closed now.
+type seatAccountBiller struct {
+	account      *seatAccount
+	nextCycleEnd func(cycleEnd time.Time) time.Time
+}
+
+func (sab seatAccountBiller) Charge(o org) bill {
+	sa := sab.account
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	b := sa.invoice(sab.nextCycleEnd(sa.cycleEnd)).bill
+	b.Customer = billedOrg{org: o, billingContact: sa.billingContact}
+	return b
+}
+
+func (sab seatAccountBiller) Name() string {
+	return "seat org biller"
+}
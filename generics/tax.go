@@ -0,0 +1,242 @@
+package generics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Taxes ---
+/*
+
+	bill and lineItem carry no tax, but our org customers need VAT/GST.
+
+	The taxTable is loaded from a local file (see tax_rates.json) with the
+	rates of every country and region. Rates are effective-dated, a bill is
+	always taxed with the rates that were in force on its date, so the taxes
+	of an old bill can be calculated again and give the same result.
+
+	A country rate (region "") and a region rate can apply at the same time,
+	for example GST + PST in Canada.
+
+	The taxCalculator adds a tax breakdown to every bill:
+
+	- taxExclusive: the price of the bill is the net amount, taxes are added on top.
+	- taxInclusive: the price of the bill already includes the taxes.
+	- Reverse charge: an org with a tax ID in another country than Mailio
+	pays no tax, the customer declares it in their own country.
+*/
+
+type taxMode string
+
+const (
+	taxExclusive taxMode = "exclusive"
+	taxInclusive taxMode = "inclusive"
+)
+
+var (
+	errNoTaxRates      = errors.New("no tax rates for jurisdiction")
+	errInvalidTaxTable = errors.New("invalid tax table")
+	errUnknownTaxMode  = errors.New("unknown tax mode")
+)
+
+type jurisdiction struct {
+	country string // ISO 3166-1 alpha-2, for example "DE"
+	region  string // empty when only the country matters
+}
+
+func (j jurisdiction) String() string {
+	if j.region == "" {
+		return j.country
+	}
+	return j.country + "-" + j.region
+}
+
+// billingProfile is what we need to know about a customer to bill them.
+type billingProfile struct {
+	jurisdiction jurisdiction
+	taxID        string   // VAT/GST number of a business customer
+	currency     currency // the customer is billed in this currency, defaultCurrency when empty
+}
+
+type taxRate struct {
+	Country       string  `json:"country"`
+	Region        string  `json:"region"`
+	Name          string  `json:"name"`
+	Rate          float64 `json:"rate"`
+	EffectiveFrom string  `json:"effective_from"`         // YYYY-MM-DD, inclusive
+	EffectiveTo   string  `json:"effective_to,omitempty"` // YYYY-MM-DD, exclusive, empty while in force
+	from          time.Time
+	to            time.Time
+}
+
+func (tr taxRate) appliesTo(j jurisdiction, at time.Time) bool {
+	if !strings.EqualFold(tr.Country, j.country) {
+		return false
+	}
+	if tr.Region != "" && !strings.EqualFold(tr.Region, j.region) {
+		return false
+	}
+	if at.Before(tr.from) {
+		return false
+	}
+	return tr.to.IsZero() || at.Before(tr.to)
+}
+
+type taxTable struct {
+	rates []taxRate
+}
+
+// loadTaxTable reads a table like:
+//
+//	{"rates": [{"country": "DE", "name": "VAT", "rate": 0.19, "effective_from": "2007-01-01"}]}
+func loadTaxTable(r io.Reader) (taxTable, error) {
+	var file struct {
+		Rates []taxRate `json:"rates"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return taxTable{}, fmt.Errorf("%w: %v", errInvalidTaxTable, err)
+	}
+	for i := range file.Rates {
+		rate := &file.Rates[i]
+		if rate.Country == "" || rate.Rate < 0 {
+			return taxTable{}, fmt.Errorf("%w: rate %d needs a country and a positive rate", errInvalidTaxTable, i)
+		}
+		from, err := time.Parse(time.DateOnly, rate.EffectiveFrom)
+		if err != nil {
+			return taxTable{}, fmt.Errorf("%w: rate %d: %v", errInvalidTaxTable, i, err)
+		}
+		rate.from = from
+		if rate.EffectiveTo != "" {
+			to, err := time.Parse(time.DateOnly, rate.EffectiveTo)
+			if err != nil {
+				return taxTable{}, fmt.Errorf("%w: rate %d: %v", errInvalidTaxTable, i, err)
+			}
+			rate.to = to
+		}
+	}
+	return taxTable{rates: file.Rates}, nil
+}
+
+func loadTaxTableFile(path string) (taxTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return taxTable{}, err
+	}
+	defer f.Close()
+	return loadTaxTable(f)
+}
+
+// ratesFor returns the rates in force in the jurisdiction at the given time.
+func (tt taxTable) ratesFor(j jurisdiction, at time.Time) ([]taxRate, error) {
+	var rates []taxRate
+	for _, rate := range tt.rates {
+		if rate.appliesTo(j, at) {
+			rates = append(rates, rate)
+		}
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%w: %s on %s", errNoTaxRates, j, at.Format(time.DateOnly))
+	}
+	return rates, nil
+}
+
+type taxLine struct {
+	name         string
+	jurisdiction string
+	rate         float64
+	amount       float64
+}
+
+type taxedBill struct {
+	bill          bill
+	mode          taxMode
+	net           float64
+	taxes         []taxLine
+	totalTax      float64
+	gross         float64
+	reverseCharge bool
+	taxedAt       time.Time // the date used to pick the rates
+}
+
+func (tb taxedBill) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "net: %.2f\n", tb.net)
+	if tb.reverseCharge {
+		sb.WriteString("VAT reverse charged to the customer\n")
+	}
+	for _, tax := range tb.taxes {
+		fmt.Fprintf(&sb, "%s %s (%.2f%%): %.2f\n", tax.jurisdiction, tax.name, tax.rate*100, tax.amount)
+	}
+	fmt.Fprintf(&sb, "total: %.2f\n", tb.gross)
+	return sb.String()
+}
+
+type taxCalculator struct {
+	table  taxTable
+	seller jurisdiction // where Mailio is registered
+}
+
+func newTaxCalculator(table taxTable, seller jurisdiction) taxCalculator {
+	return taxCalculator{table: table, seller: seller}
+}
+
+// taxBill calculates the taxes of a bill issued at the given time.
+func (tc taxCalculator) taxBill(b bill, profile billingProfile, mode taxMode, at time.Time) (taxedBill, error) {
+	if mode != taxExclusive && mode != taxInclusive {
+		return taxedBill{}, errUnknownTaxMode
+	}
+	taxed := taxedBill{bill: b, mode: mode, taxedAt: at}
+	if tc.isReverseCharge(b.Customer, profile) {
+		taxed.reverseCharge = true
+		taxed.net = roundCents(b.Amount)
+		taxed.gross = taxed.net
+		return taxed, nil
+	}
+
+	rates, err := tc.table.ratesFor(profile.jurisdiction, at)
+	if err != nil {
+		return taxedBill{}, err
+	}
+	totalRate := 0.0
+	for _, rate := range rates {
+		totalRate += rate.Rate
+	}
+	if mode == taxInclusive {
+		taxed.net = roundCents(b.Amount / (1 + totalRate))
+	} else {
+		taxed.net = roundCents(b.Amount)
+	}
+	for _, rate := range rates {
+		j := jurisdiction{country: rate.Country, region: rate.Region}
+		line := taxLine{
+			name:         rate.Name,
+			jurisdiction: j.String(),
+			rate:         rate.Rate,
+			amount:       roundCents(taxed.net * rate.Rate),
+		}
+		taxed.taxes = append(taxed.taxes, line)
+		taxed.totalTax += line.amount
+	}
+	taxed.totalTax = roundCents(taxed.totalTax)
+	if mode == taxInclusive {
+		// the customer pays the price of the bill, rounding goes to the net amount
+		taxed.gross = roundCents(b.Amount)
+		taxed.net = roundCents(taxed.gross - taxed.totalTax)
+	} else {
+		taxed.gross = roundCents(taxed.net + taxed.totalTax)
+	}
+	return taxed, nil
+}
+
+// isReverseCharge is true for business customers (orgs with a tax ID) in another country.
+func (tc taxCalculator) isReverseCharge(c customer, profile billingProfile) bool {
+	if _, ok := c.(org); !ok {
+		return false
+	}
+	return profile.taxID != "" && !strings.EqualFold(profile.jurisdiction.country, tc.seller.country)
+}
@@ -0,0 +1,196 @@
+package interfaces
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Expense Reports ---
+/*
+
+	getExpenseReport answers for ONE expense, and an expense it doesn't
+	know (like invalid) silently costs 0. For billing we need a report over
+	every expense of a period:
+
+	- grouped by kind (email, sms...), recipient and day.
+	- with the subscribed and unsubscribed expenses apart, they have
+	different rates.
+	- exported to CSV or JSON.
+
+	Expense kinds register themselves with registerExpenseKind, usually in
+	an init function next to their type, so the report never needs a
+	type switch. An expense of a kind nobody registered is reported as an
+	error instead of costing 0.
+*/
+
+var errUnknownExpenseKind = errors.New("unknown expense kind")
+
+// expenseInfo is what the report needs to know about an expense, besides its cost.
+type expenseInfo struct {
+	kind       string
+	recipient  string
+	subscribed bool
+}
+
+type expenseRegistry struct {
+	mu    *sync.RWMutex
+	kinds map[reflect.Type]func(expense) expenseInfo
+}
+
+func newExpenseRegistry() *expenseRegistry {
+	return &expenseRegistry{
+		mu:    &sync.RWMutex{},
+		kinds: map[reflect.Type]func(expense) expenseInfo{},
+	}
+}
+
+// expenseKinds is the registry every expense kind of the package registers in.
+var expenseKinds = newExpenseRegistry()
+
+// registerExpenseKind teaches the registry how to read the expenses of type E.
+func registerExpenseKind[E expense](r *expenseRegistry, kind string, describe func(E) (recipient string, subscribed bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[reflect.TypeFor[E]()] = func(e expense) expenseInfo {
+		recipient, subscribed := describe(e.(E))
+		return expenseInfo{kind: kind, recipient: recipient, subscribed: subscribed}
+	}
+}
+
+func (r *expenseRegistry) describe(e expense) (expenseInfo, error) {
+	r.mu.RLock()
+	describe, ok := r.kinds[reflect.TypeOf(e)]
+	r.mu.RUnlock()
+	if !ok {
+		return expenseInfo{}, fmt.Errorf("%w: %T", errUnknownExpenseKind, e)
+	}
+	return describe(e), nil
+}
+
+func init() {
+	registerExpenseKind(expenseKinds, "email", func(e email) (string, bool) {
+		return e.toAddress, e.isSubscribed
+	})
+	registerExpenseKind(expenseKinds, "sms", func(s sms) (string, bool) {
+		return s.toPhoneNumber, s.isSubscribed
+	})
+}
+
+// datedExpense is an expense and the moment it happened.
+type datedExpense struct {
+	expense expense
+	at      time.Time
+}
+
+type expenseReportRow struct {
+	Kind              string  `json:"kind"`
+	Recipient         string  `json:"recipient"`
+	Day               string  `json:"day"`
+	SubscribedCount   int     `json:"subscribed_count"`
+	SubscribedCost    float64 `json:"subscribed_cost"`
+	UnsubscribedCount int     `json:"unsubscribed_count"`
+	UnsubscribedCost  float64 `json:"unsubscribed_cost"`
+	TotalCost         float64 `json:"total_cost"`
+}
+
+type expenseReport struct {
+	Rows      []expenseReportRow `json:"rows"`
+	TotalCost float64            `json:"total_cost"`
+	// Skipped counts the expenses of unknown kinds, they are not in the rows.
+	Skipped int `json:"skipped"`
+}
+
+// buildExpenseReport groups the expenses by kind, recipient and day (in the location of their time).
+// Expenses of unknown kinds are skipped and returned as errors, the report is still built.
+func buildExpenseReport(r *expenseRegistry, expenses []datedExpense) (expenseReport, error) {
+	type groupKey struct {
+		kind, recipient, day string
+	}
+	groups := map[groupKey]*expenseReportRow{}
+	report := expenseReport{Rows: []expenseReportRow{}}
+	var errs []error
+	for i, de := range expenses {
+		info, err := r.describe(de.expense)
+		if err != nil {
+			report.Skipped++
+			errs = append(errs, fmt.Errorf("expense %d: %w", i, err))
+			continue
+		}
+		key := groupKey{kind: info.kind, recipient: info.recipient, day: de.at.Format(time.DateOnly)}
+		row, ok := groups[key]
+		if !ok {
+			row = &expenseReportRow{Kind: key.kind, Recipient: key.recipient, Day: key.day}
+			groups[key] = row
+		}
+		cost := de.expense.cost()
+		if info.subscribed {
+			row.SubscribedCount++
+			row.SubscribedCost += cost
+		} else {
+			row.UnsubscribedCount++
+			row.UnsubscribedCost += cost
+		}
+	}
+
+	for _, row := range groups {
+		row.SubscribedCost = roundCents(row.SubscribedCost)
+		row.UnsubscribedCost = roundCents(row.UnsubscribedCost)
+		row.TotalCost = roundCents(row.SubscribedCost + row.UnsubscribedCost)
+		report.TotalCost += row.TotalCost
+		report.Rows = append(report.Rows, *row)
+	}
+	report.TotalCost = roundCents(report.TotalCost)
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Recipient < b.Recipient
+	})
+	return report, errors.Join(errs...)
+}
+
+func (er expenseReport) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"day", "kind", "recipient", "subscribed_count", "subscribed_cost", "unsubscribed_count", "unsubscribed_cost", "total_cost"})
+	for _, row := range er.Rows {
+		cw.Write([]string{
+			row.Day,
+			row.Kind,
+			row.Recipient,
+			strconv.Itoa(row.SubscribedCount),
+			formatCost(row.SubscribedCost),
+			strconv.Itoa(row.UnsubscribedCount),
+			formatCost(row.UnsubscribedCost),
+			formatCost(row.TotalCost),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (er expenseReport) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(er)
+}
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 2, 64)
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -1,8 +1,11 @@
 package interfaces
 
 import (
+	"context"
 	"fmt"
 	"math"
+
+	"github.com/daniela2001-png/freecodecamp_go_course/fsm"
 )
 
 // --- INTERFACES ---
@@ -59,18 +62,43 @@ func sendMessage(msg message) {
 type mailMessage struct {
 	recipient string
 	sender    string
+	subject   string
+	body      string
 }
 
 func (mailmsg mailMessage) getMessage() string {
 	return fmt.Sprintf("Sending mail msg from %s to %s", mailmsg.sender, mailmsg.recipient)
 }
 
+func (mailmsg mailMessage) senderAccount() string {
+	return mailmsg.sender
+}
+
 type SMSMessage struct {
 	phoneNumber int
+	body        string
+	// account sends the message, it is blocked while the account is suspended
+	account string
+	// id and status are set once the message is sent, see SMSOutbox
+	id     string
+	status DeliveryStatus
 }
 
 func (smsmsg SMSMessage) getMessage() string {
-	return fmt.Sprintf("Sending SMS msg to phone number %d", smsmsg.phoneNumber)
+	return fmt.Sprintf("Sending SMS msg to phone number %d (%d segments)", smsmsg.phoneNumber, countSegments(smsmsg.body))
+}
+
+func (smsmsg SMSMessage) senderAccount() string {
+	return smsmsg.account
+}
+
+func (smsmsg SMSMessage) recipientPhoneNumber() int {
+	return smsmsg.phoneNumber
+}
+
+// segments splits the message with a new concatenation reference, call it once per send.
+func (smsmsg SMSMessage) segments() (smsSegmentation, error) {
+	return splitSMS(smsmsg.body, nextSMSReference())
 }
 
 // calling sendMessage() method:
@@ -86,6 +114,29 @@ func interfaceEntryPoint() {
 	sendMessage(mailMsg)
 }
 
+// SendMail and SendSMS let other packages (like the dunning workflow in
+// the generics package) send messages without knowing the message types.
+// They deliver through DefaultRouter (see providers.go), nothing is sent
+// while the sender account is suspended.
+func SendMail(sender, recipient, subject, body string) error {
+	_, err := DefaultRouter.Send(context.Background(), mailMessage{
+		sender:    sender,
+		recipient: recipient,
+		subject:   subject,
+		body:      body,
+	})
+	return err
+}
+
+func SendSMS(account string, phoneNumber int, body string) error {
+	_, err := DefaultRouter.Send(context.Background(), SMSMessage{
+		phoneNumber: phoneNumber,
+		body:        body,
+		account:     account,
+	})
+	return err
+}
+
 // --- Interface Implementation ---
 type employee interface {
 	getName() string
@@ -238,11 +289,13 @@ type sms struct {
 	isSubscribed  bool
 }
 
+// cost is charged per segment, see sms_encoding.go
 func (s sms) cost() float64 {
+	segments := float64(countSegments(s.body))
 	if !s.isSubscribed {
-		return float64(len(s.body)) * .1
+		return segments * .1
 	}
-	return float64(len(s.body)) * .03
+	return segments * .03
 }
 
 func getExpenseReport(e expense) (expenseTypeInfo string, cost float64) {
@@ -382,7 +435,67 @@ func manageTypesOfOS(c ComputerManagerV2) (msg string) {
 		return fmt.Sprintf("we have a %s computer", v.getOS())
 	case LinuxComputer:
 		return fmt.Sprintf("we have a %s computer", v.getOS())
+	case StatefulComputer:
+		return fmt.Sprintf("we have a %s computer", v.getOS())
 	default:
 		return
 	}
 }
+
+// --- Computers with a state machine ---
+/*
+
+	LinuxComputer has isOn AND isOff, nothing stops both from being true.
+	StatefulComputer keeps its power state in a state machine (see the fsm
+	package), so it can only be on or off, and turning on a computer that
+	is already on is rejected.
+
+	It still implements ComputerManagerV2: turnOn and turnOff return true
+	when the computer changed its state.
+*/
+
+type powerState string
+
+const (
+	powerOff powerState = "off"
+	powerOn  powerState = "on"
+)
+
+type powerEvent string
+
+const (
+	pressTurnOn  powerEvent = "turn on"
+	pressTurnOff powerEvent = "turn off"
+)
+
+type StatefulComputer struct {
+	nameOS string
+	power  *fsm.Machine[powerState, powerEvent]
+}
+
+func NewStatefulComputer(nameOS string) (StatefulComputer, error) {
+	power, err := fsm.NewMachine(powerOff,
+		fsm.Transition[powerState, powerEvent]{From: powerOff, Event: pressTurnOn, To: powerOn},
+		fsm.Transition[powerState, powerEvent]{From: powerOn, Event: pressTurnOff, To: powerOff},
+	)
+	if err != nil {
+		return StatefulComputer{}, err
+	}
+	return StatefulComputer{nameOS: nameOS, power: power}, nil
+}
+
+func (c StatefulComputer) turnOn() bool {
+	return c.power.Fire(pressTurnOn) == nil
+}
+
+func (c StatefulComputer) turnOff() bool {
+	return c.power.Fire(pressTurnOff) == nil
+}
+
+func (c StatefulComputer) getOS() string {
+	return c.nameOS
+}
+
+func (c StatefulComputer) isOn() bool {
+	return c.power.Is(powerOn)
+}
@@ -0,0 +1,284 @@
+package interfaces
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- One-Time Passcodes ---
+/*
+
+	Verification codes ("your code is 482913") are one of the most common
+	transactional messages. OTPService:
+
+	- generates random numeric codes and sends them by email or SMS
+	through a Router.
+	- never stores a code, only its HMAC, so a dump of the memory (or of a
+	future database) doesn't leak valid codes.
+	- expires codes after TTL and locks them after MaxAttempts wrong guesses.
+	A code can be used only once, sending a new code replaces the old one.
+	- throttles the send path per recipient: a minimum time between two
+	codes and a maximum number of codes per window. Without it anybody
+	could use us to spam a phone number.
+*/
+
+type OTPChannel string
+
+const (
+	OTPEmail OTPChannel = "email"
+	OTPSMS   OTPChannel = "sms"
+)
+
+var (
+	ErrOTPNotFound         = errors.New("no pending code for recipient")
+	ErrOTPExpired          = errors.New("code expired")
+	ErrOTPInvalid          = errors.New("invalid code")
+	ErrOTPTooManyAttempts  = errors.New("too many attempts, request a new code")
+	ErrOTPThrottled        = errors.New("too many codes requested")
+	ErrOTPUnknownChannel   = errors.New("unknown otp channel")
+	ErrOTPInvalidRecipient = errors.New("invalid otp recipient")
+)
+
+// OTPThrottleError tells when the recipient can ask for a new code.
+type OTPThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPThrottleError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", ErrOTPThrottled, e.RetryAfter.Round(time.Second))
+}
+
+func (e *OTPThrottleError) Unwrap() error {
+	return ErrOTPThrottled
+}
+
+type OTPConfig struct {
+	// From is the sender of the emails.
+	From        string
+	Digits      int
+	TTL         time.Duration
+	MaxAttempts int
+	// ResendInterval is the minimum time between two codes for a recipient.
+	ResendInterval time.Duration
+	// MaxSends codes can be sent to a recipient every SendWindow.
+	MaxSends   int
+	SendWindow time.Duration
+}
+
+func DefaultOTPConfig() OTPConfig {
+	return OTPConfig{
+		From:           "no-reply@mailio.com",
+		Digits:         6,
+		TTL:            5 * time.Minute,
+		MaxAttempts:    5,
+		ResendInterval: 30 * time.Second,
+		MaxSends:       5,
+		SendWindow:     time.Hour,
+	}
+}
+
+type otpEntry struct {
+	hash      []byte
+	expiresAt time.Time
+	attempts  int
+}
+
+type OTPService struct {
+	mu     *sync.Mutex
+	router *Router
+	config OTPConfig
+	secret []byte
+	codes  map[string]*otpEntry   // by channel and recipient
+	sends  map[string][]time.Time // send times inside the window, by channel and recipient
+	now    func() time.Time
+}
+
+// NewOTPService sends the codes with router, the zero fields of config take the default values.
+func NewOTPService(router *Router, config OTPConfig) (*OTPService, error) {
+	defaults := DefaultOTPConfig()
+	if config.From == "" {
+		config.From = defaults.From
+	}
+	if config.Digits <= 0 {
+		config.Digits = defaults.Digits
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaults.TTL
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.ResendInterval <= 0 {
+		config.ResendInterval = defaults.ResendInterval
+	}
+	if config.MaxSends <= 0 {
+		config.MaxSends = defaults.MaxSends
+	}
+	if config.SendWindow <= 0 {
+		config.SendWindow = defaults.SendWindow
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &OTPService{
+		mu:     &sync.Mutex{},
+		router: router,
+		config: config,
+		secret: secret,
+		codes:  map[string]*otpEntry{},
+		sends:  map[string][]time.Time{},
+		now:    time.Now,
+	}, nil
+}
+
+// Send generates a code for recipient (an email address or a phone number) and sends it.
+func (s *OTPService) Send(ctx context.Context, channel OTPChannel, recipient string) error {
+	recipient, err := normalizeOTPRecipient(channel, recipient)
+	if err != nil {
+		return err
+	}
+	code, err := s.generate()
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Your Mailio verification code is %s. It expires in %s.", code, s.config.TTL)
+
+	var msg message
+	switch channel {
+	case OTPEmail:
+		msg = mailMessage{sender: s.config.From, recipient: recipient, subject: "Your Mailio verification code", body: text}
+	case OTPSMS:
+		// normalizeOTPRecipient checked that it fits an int
+		phoneNumber, _ := strconv.Atoi(recipient)
+		msg = SMSMessage{phoneNumber: phoneNumber, body: text, account: s.config.From}
+	}
+
+	key := otpKey(channel, recipient)
+	s.mu.Lock()
+	now := s.now()
+	if err := s.throttle(key, now); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.sends[key] = append(s.sends[key], now)
+	entry := &otpEntry{hash: s.hash(key, code), expiresAt: now.Add(s.config.TTL)}
+	s.codes[key] = entry
+	s.mu.Unlock()
+
+	if _, err := s.router.Send(ctx, msg); err != nil {
+		// the code never arrived, don't let it be verified (the send still counts for the throttle)
+		s.mu.Lock()
+		if s.codes[key] == entry {
+			delete(s.codes, key)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Verify checks code, a code that matches can't be used again.
+func (s *OTPService) Verify(channel OTPChannel, recipient, code string) error {
+	recipient, err := normalizeOTPRecipient(channel, recipient)
+	if err != nil {
+		return err
+	}
+	key := otpKey(channel, recipient)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.codes[key]
+	if !ok {
+		return ErrOTPNotFound
+	}
+	if !s.now().Before(entry.expiresAt) {
+		delete(s.codes, key)
+		return ErrOTPExpired
+	}
+	if !hmac.Equal(entry.hash, s.hash(key, strings.TrimSpace(code))) {
+		entry.attempts++
+		if entry.attempts >= s.config.MaxAttempts {
+			delete(s.codes, key)
+			return ErrOTPTooManyAttempts
+		}
+		return ErrOTPInvalid
+	}
+	delete(s.codes, key)
+	return nil
+}
+
+// throttle must be called with the mutex locked, it drops the sends that left the window.
+func (s *OTPService) throttle(key string, now time.Time) error {
+	var recent []time.Time
+	for _, at := range s.sends[key] {
+		if now.Sub(at) < s.config.SendWindow {
+			recent = append(recent, at)
+		}
+	}
+	s.sends[key] = recent
+	if len(recent) == 0 {
+		return nil
+	}
+	if wait := s.config.ResendInterval - now.Sub(recent[len(recent)-1]); wait > 0 {
+		return &OTPThrottleError{RetryAfter: wait}
+	}
+	if len(recent) >= s.config.MaxSends {
+		return &OTPThrottleError{RetryAfter: s.config.SendWindow - now.Sub(recent[0])}
+	}
+	return nil
+}
+
+// generate returns a uniformly random code of config.Digits digits.
+func (s *OTPService) generate() (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(s.config.Digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", s.config.Digits, n), nil
+}
+
+// hash binds the code to its recipient, the same code for two recipients has two hashes.
+func (s *OTPService) hash(key, code string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write([]byte(code))
+	return mac.Sum(nil)
+}
+
+// normalizeOTPRecipient is used by Send and Verify, so a code is always stored and
+// looked up under the same key, however the recipient was written.
+func normalizeOTPRecipient(channel OTPChannel, recipient string) (string, error) {
+	recipient = strings.TrimSpace(recipient)
+	switch channel {
+	case OTPEmail:
+		if !strings.Contains(recipient, "@") {
+			return "", ErrOTPInvalidRecipient
+		}
+		return recipient, nil
+	case OTPSMS:
+		number, err := normalizePhoneNumber(recipient)
+		if err != nil {
+			return "", ErrOTPInvalidRecipient
+		}
+		if _, err := strconv.Atoi(number); err != nil {
+			return "", ErrOTPInvalidRecipient
+		}
+		return number, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrOTPUnknownChannel, channel)
+}
+
+func otpKey(channel OTPChannel, recipient string) string {
+	return string(channel) + ":" + strings.ToLower(recipient)
+}
@@ -0,0 +1,353 @@
+package interfaces
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Payroll ---
+/*
+
+	getSalary returns a whole year of pay, but people are paid every week,
+	two weeks or month, and they don't get the whole amount: taxes and
+	deductions come out first.
+
+	- A payCalendar cuts the year in pay periods.
+	- fullTime employees get their salary divided by the periods of the year,
+	contractors get the hours of their timesheet (loaded from CSV) times
+	their hourly pay.
+	- payrollRules turn gross pay into net pay: pre-tax deductions (like
+	retirement) lower the taxable pay, taxes are computed on what is
+	left, post-tax deductions (like health insurance) come last.
+	- runPayroll pays every employee of a period and returns their
+	payslips (see payslip.go) and the totals.
+*/
+
+var (
+	errUnknownPayFrequency = errors.New("unknown pay frequency")
+	errInvalidTimesheet    = errors.New("invalid timesheet")
+)
+
+type payFrequency string
+
+const (
+	payWeekly      payFrequency = "weekly"
+	payBiweekly    payFrequency = "biweekly"
+	paySemimonthly payFrequency = "semimonthly"
+	payMonthly     payFrequency = "monthly"
+)
+
+func (pf payFrequency) periodsPerYear() (int, error) {
+	switch pf {
+	case payWeekly:
+		return 52, nil
+	case payBiweekly:
+		return 26, nil
+	case paySemimonthly:
+		return 24, nil
+	case payMonthly:
+		return 12, nil
+	}
+	return 0, fmt.Errorf("%w: %q", errUnknownPayFrequency, pf)
+}
+
+// payPeriod goes from start (included) to end (excluded).
+type payPeriod struct {
+	start time.Time
+	end   time.Time
+}
+
+func (pp payPeriod) contains(t time.Time) bool {
+	return !t.Before(pp.start) && t.Before(pp.end)
+}
+
+func (pp payPeriod) String() string {
+	return fmt.Sprintf("%s to %s", pp.start.Format(time.DateOnly), pp.end.AddDate(0, 0, -1).Format(time.DateOnly))
+}
+
+type payCalendar struct {
+	frequency payFrequency
+	// anchor is the first day of a weekly or biweekly period, the others follow each other from it.
+	anchor time.Time
+}
+
+// period returns the pay period that contains at.
+func (pc payCalendar) period(at time.Time) (payPeriod, error) {
+	y, m, d := at.Date()
+	loc := at.Location()
+	switch pc.frequency {
+	case payMonthly:
+		start := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		return payPeriod{start: start, end: start.AddDate(0, 1, 0)}, nil
+	case paySemimonthly:
+		if d <= 15 {
+			start := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+			return payPeriod{start: start, end: start.AddDate(0, 0, 15)}, nil
+		}
+		start := time.Date(y, m, 16, 0, 0, 0, 0, loc)
+		return payPeriod{start: start, end: time.Date(y, m+1, 1, 0, 0, 0, 0, loc)}, nil
+	case payWeekly, payBiweekly:
+		days := 7
+		if pc.frequency == payBiweekly {
+			days = 14
+		}
+		ay, am, ad := pc.anchor.Date()
+		anchor := time.Date(ay, am, ad, 0, 0, 0, 0, loc)
+		day := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		// whole days between the anchor and at, rounded to absorb daylight saving changes
+		elapsed := int(day.Sub(anchor).Round(24*time.Hour).Hours() / 24)
+		offset := elapsed % days
+		if offset < 0 {
+			offset += days
+		}
+		start := day.AddDate(0, 0, -offset)
+		return payPeriod{start: start, end: start.AddDate(0, 0, days)}, nil
+	}
+	return payPeriod{}, fmt.Errorf("%w: %q", errUnknownPayFrequency, pc.frequency)
+}
+
+// --- Timesheets ---
+
+type timesheetEntry struct {
+	name  string
+	date  time.Time
+	hours float64
+}
+
+type timesheets struct {
+	entries map[string][]timesheetEntry // by name
+}
+
+// loadTimesheets reads a CSV with the header "name,date,hours", dates are YYYY-MM-DD.
+// Every bad line is reported, with its line number.
+func loadTimesheets(r io.Reader) (timesheets, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	ts := timesheets{entries: map[string][]timesheetEntry{}}
+
+	header, err := reader.Read()
+	if err != nil {
+		return ts, fmt.Errorf("%w: %w", errInvalidTimesheet, err)
+	}
+	if strings.ToLower(strings.Join(header, ",")) != "name,date,hours" {
+		return ts, fmt.Errorf("%w: header must be name,date,hours", errInvalidTimesheet)
+	}
+
+	var errs []error
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				// the reader itself failed, the next reads would fail too
+				return ts, errors.Join(append(errs, fmt.Errorf("%w: %w", errInvalidTimesheet, err))...)
+			}
+			errs = append(errs, fmt.Errorf("%w: line %d: %w", errInvalidTimesheet, parseErr.Line, parseErr.Err))
+			continue
+		}
+		// FieldPos is only valid for a record that was read without error
+		line, _ := reader.FieldPos(0)
+		date, err := time.Parse(time.DateOnly, record[1])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: line %d: date %q", errInvalidTimesheet, line, record[1]))
+			continue
+		}
+		hours, err := strconv.ParseFloat(record[2], 64)
+		if err != nil || hours < 0 || hours > 24 {
+			errs = append(errs, fmt.Errorf("%w: line %d: hours %q", errInvalidTimesheet, line, record[2]))
+			continue
+		}
+		name := strings.TrimSpace(record[0])
+		ts.entries[name] = append(ts.entries[name], timesheetEntry{name: name, date: date, hours: hours})
+	}
+	return ts, errors.Join(errs...)
+}
+
+// hours returns the hours worked by name during the period.
+func (ts timesheets) hours(name string, period payPeriod) float64 {
+	total := 0.0
+	for _, entry := range ts.entries[name] {
+		// timesheet dates have no location, compare them as calendar days of the period
+		day := time.Date(entry.date.Year(), entry.date.Month(), entry.date.Day(), 0, 0, 0, 0, period.start.Location())
+		if period.contains(day) {
+			total += entry.hours
+		}
+	}
+	return total
+}
+
+// --- Gross to net ---
+
+type deductionKind string
+
+const (
+	deductionPreTax  deductionKind = "pre-tax"
+	deductionTax     deductionKind = "tax"
+	deductionPostTax deductionKind = "post-tax"
+)
+
+// payState is what a rule sees: taxable is the gross pay minus the pre-tax deductions.
+type payState struct {
+	gross          float64
+	taxable        float64
+	periodsPerYear int
+}
+
+type payrollRule interface {
+	ruleName() string
+	kind() deductionKind
+	amount(ps payState) float64
+}
+
+// percentDeduction takes rate of the gross pay (pre-tax) or of the taxable pay (tax, post-tax).
+type percentDeduction struct {
+	name          string
+	deductionKind deductionKind
+	rate          float64
+}
+
+func (pd percentDeduction) ruleName() string    { return pd.name }
+func (pd percentDeduction) kind() deductionKind { return pd.deductionKind }
+func (pd percentDeduction) amount(ps payState) float64 {
+	if pd.deductionKind == deductionPreTax {
+		return ps.gross * pd.rate
+	}
+	return ps.taxable * pd.rate
+}
+
+// fixedDeduction takes the same amount every period.
+type fixedDeduction struct {
+	name          string
+	deductionKind deductionKind
+	perPeriod     float64
+}
+
+func (fd fixedDeduction) ruleName() string           { return fd.name }
+func (fd fixedDeduction) kind() deductionKind        { return fd.deductionKind }
+func (fd fixedDeduction) amount(ps payState) float64 { return fd.perPeriod }
+
+type taxBracket struct {
+	upTo float64 // annual taxable pay, 0 means no limit
+	rate float64
+}
+
+// progressiveTax annualizes the taxable pay of the period, applies the brackets
+// and gives back the share of one period.
+type progressiveTax struct {
+	name     string
+	brackets []taxBracket // sorted by upTo, the last one with upTo 0
+}
+
+func (pt progressiveTax) ruleName() string    { return pt.name }
+func (pt progressiveTax) kind() deductionKind { return deductionTax }
+func (pt progressiveTax) amount(ps payState) float64 {
+	annual := ps.taxable * float64(ps.periodsPerYear)
+	tax, lower := 0.0, 0.0
+	for _, bracket := range pt.brackets {
+		upper := bracket.upTo
+		if upper == 0 || annual < upper {
+			upper = annual
+		}
+		if upper > lower {
+			tax += (upper - lower) * bracket.rate
+		}
+		if bracket.upTo == 0 || annual <= bracket.upTo {
+			break
+		}
+		lower = bracket.upTo
+	}
+	return tax / float64(ps.periodsPerYear)
+}
+
+type payrollConfig struct {
+	calendar payCalendar
+	// employeeRules apply to every employee but contractors, contractorRules to contractors.
+	employeeRules   []payrollRule
+	contractorRules []payrollRule
+}
+
+func (pc payrollConfig) rulesFor(e employee) []payrollRule {
+	if _, ok := e.(contractor); ok {
+		return pc.contractorRules
+	}
+	return pc.employeeRules
+}
+
+// payrollRun is the result of paying every employee for one period.
+type payrollRun struct {
+	period          payPeriod
+	payslips        []payslip
+	totalGross      float64
+	totalDeductions float64
+	totalNet        float64
+}
+
+// runPayroll pays every employee for the period that contains at.
+func runPayroll(employees []employee, config payrollConfig, ts timesheets, at time.Time) (payrollRun, error) {
+	period, err := config.calendar.period(at)
+	if err != nil {
+		return payrollRun{}, err
+	}
+	periodsPerYear, err := config.calendar.frequency.periodsPerYear()
+	if err != nil {
+		return payrollRun{}, err
+	}
+	run := payrollRun{period: period}
+	for _, e := range employees {
+		slip := computePayslip(e, config.rulesFor(e), ts, period, periodsPerYear)
+		run.payslips = append(run.payslips, slip)
+		run.totalGross += slip.gross
+		run.totalDeductions += slip.totalDeductions()
+		run.totalNet += slip.net
+	}
+	run.totalGross = roundCents(run.totalGross)
+	run.totalDeductions = roundCents(run.totalDeductions)
+	run.totalNet = roundCents(run.totalNet)
+	return run, nil
+}
+
+// computePayslip runs the pre-tax rules first, then the taxes and the post-tax rules last,
+// whatever their order in the config. Net pay never goes below zero.
+func computePayslip(e employee, rules []payrollRule, ts timesheets, period payPeriod, periodsPerYear int) payslip {
+	slip := payslip{name: e.getName(), period: period}
+	if c, ok := e.(contractor); ok {
+		slip.hours = ts.hours(c.getName(), period)
+		slip.hourlyRate = float64(c.hourlyPay)
+		slip.gross = roundCents(slip.hours * slip.hourlyRate)
+	} else {
+		slip.gross = roundCents(float64(e.getSalary()) / float64(periodsPerYear))
+	}
+
+	ordered := append([]payrollRule(nil), rules...)
+	rank := map[deductionKind]int{deductionPreTax: 0, deductionTax: 1, deductionPostTax: 2}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rank[ordered[i].kind()] < rank[ordered[j].kind()]
+	})
+
+	ps := payState{gross: slip.gross, taxable: slip.gross, periodsPerYear: periodsPerYear}
+	net := slip.gross
+	for _, rule := range ordered {
+		amount := roundCents(min(rule.amount(ps), net))
+		if amount <= 0 {
+			continue
+		}
+		net -= amount
+		if rule.kind() == deductionPreTax {
+			ps.taxable -= amount
+		}
+		slip.deductions = append(slip.deductions, payslipLine{name: rule.ruleName(), kind: rule.kind(), amount: amount})
+	}
+	slip.taxable = roundCents(ps.taxable)
+	slip.net = roundCents(net)
+	return slip
+}
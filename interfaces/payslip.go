@@ -0,0 +1,111 @@
+package interfaces
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// --- Payslips ---
+/*
+
+	A payslip tells an employee how their net pay was computed: the gross
+	pay (hours x rate for contractors), every deduction and the net pay.
+	It can be written as plain text (for emails) or HTML. The HTML template
+	escapes every value, names come from our users.
+*/
+
+type payslipLine struct {
+	name   string
+	kind   deductionKind
+	amount float64
+}
+
+type payslip struct {
+	name       string
+	period     payPeriod
+	hours      float64 // contractors only
+	hourlyRate float64 // contractors only
+	gross      float64
+	taxable    float64
+	deductions []payslipLine
+	net        float64
+}
+
+func (ps payslip) totalDeductions() float64 {
+	total := 0.0
+	for _, line := range ps.deductions {
+		total += line.amount
+	}
+	return roundCents(total)
+}
+
+func (ps payslip) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Payslip\t%s\t\n", ps.name)
+	fmt.Fprintf(tw, "Period\t%s\t\n", ps.period)
+	if ps.hourlyRate > 0 {
+		fmt.Fprintf(tw, "Hours\t%.2f x %s\t\n", ps.hours, formatCost(ps.hourlyRate))
+	}
+	fmt.Fprintf(tw, "Gross pay\t%s\t\n", formatCost(ps.gross))
+	for _, line := range ps.deductions {
+		fmt.Fprintf(tw, "%s (%s)\t-%s\t\n", line.name, line.kind, formatCost(line.amount))
+	}
+	fmt.Fprintf(tw, "Net pay\t%s\t\n", formatCost(ps.net))
+	return tw.Flush()
+}
+
+var payslipTemplate = template.Must(template.New("payslip").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Payslip {{.Name}}</title></head>
+<body>
+<h1>Payslip</h1>
+<p>{{.Name}}<br>{{.Period}}</p>
+<table>
+{{- if .Hours}}
+<tr><td>Hours</td><td>{{.Hours}}</td></tr>
+{{- end}}
+<tr><td>Gross pay</td><td>{{.Gross}}</td></tr>
+{{- range .Deductions}}
+<tr><td>{{.Name}} ({{.Kind}})</td><td>-{{.Amount}}</td></tr>
+{{- end}}
+<tr><th>Net pay</th><th>{{.Net}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+func (ps payslip) writeHTML(w io.Writer) error {
+	type line struct{ Name, Kind, Amount string }
+	data := struct {
+		Name, Period, Hours, Gross, Net string
+		Deductions                      []line
+	}{
+		Name:   ps.name,
+		Period: ps.period.String(),
+		Gross:  formatCost(ps.gross),
+		Net:    formatCost(ps.net),
+	}
+	if ps.hourlyRate > 0 {
+		data.Hours = fmt.Sprintf("%.2f x %s", ps.hours, formatCost(ps.hourlyRate))
+	}
+	for _, d := range ps.deductions {
+		data.Deductions = append(data.Deductions, line{Name: d.name, Kind: string(d.kind), Amount: formatCost(d.amount)})
+	}
+	return payslipTemplate.Execute(w, data)
+}
+
+// writeSummary writes one line per payslip and the totals of the run.
+func (pr payrollRun) writeSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Payroll %s\n", pr.period)
+	fmt.Fprintln(tw, "employee\tgross\tdeductions\tnet")
+	for _, slip := range pr.payslips {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", slip.name, formatCost(slip.gross), formatCost(slip.totalDeductions()), formatCost(slip.net))
+	}
+	fmt.Fprintln(tw, strings.Repeat("-", 8)+"\t\t\t")
+	fmt.Fprintf(tw, "total\t%s\t%s\t%s\n", formatCost(pr.totalGross), formatCost(pr.totalDeductions), formatCost(pr.totalNet))
+	return tw.Flush()
+}
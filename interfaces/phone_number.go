@@ -0,0 +1,80 @@
+package interfaces
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- Phone Numbers ---
+/*
+
+	The same number reaches us written in many ways: "+1 555-000-1111"
+	from a gateway webhook, "0015550001111" from a form, and 15550001111
+	as the int of SMSMessage. normalizePhoneNumber turns all of them into
+	the same key, the digits without the international prefix ("+" or "00")
+	and without leading zeros, which is what strconv.Itoa gives for the int.
+
+	Every place that compares numbers (opt-outs, OTP codes, threads) must
+	use it, otherwise "+15550001111" and 15550001111 are two numbers.
+*/
+
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+func normalizePhoneNumber(raw string) (string, error) {
+	var digits strings.Builder
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			// separators
+		case r == '+' && digits.Len() == 0:
+			// international prefix
+		default:
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+	number := strings.TrimLeft(digits.String(), "0")
+	if number == "" {
+		return "", ErrInvalidPhoneNumber
+	}
+	return number, nil
+}
+
+// phoneNumberKey is normalizePhoneNumber for the int numbers of SMSMessage.
+func phoneNumberKey(phoneNumber int) string {
+	return strconv.Itoa(phoneNumber)
+}
+
+// --- SMS opt-outs ---
+
+// OptOutList keeps the numbers that replied STOP. SMSInbound fills it and the
+// Router checks it before every SMS, so both must get the same list.
+type OptOutList struct {
+	mu      *sync.RWMutex
+	numbers map[string]bool // by normalized number
+}
+
+func NewOptOutList() *OptOutList {
+	return &OptOutList{mu: &sync.RWMutex{}, numbers: map[string]bool{}}
+}
+
+func (ol *OptOutList) optOut(number string) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	ol.numbers[number] = true
+}
+
+func (ol *OptOutList) optIn(number string) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	delete(ol.numbers, number)
+}
+
+func (ol *OptOutList) isOptedOut(number string) bool {
+	ol.mu.RLock()
+	defer ol.mu.RUnlock()
+	return ol.numbers[number]
+}
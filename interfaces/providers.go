@@ -0,0 +1,329 @@
+package interfaces
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	mailerrors "github.com/daniela2001-png/freecodecamp_go_course/errors"
+	"github.com/daniela2001-png/freecodecamp_go_course/mailer"
+)
+
+// --- Delivery Providers ---
+/*
+
+	sendMessage only prints the message. To really deliver it we need one
+	Provider per channel:
+
+	- SMTPProvider sends a mailMessage to an SMTP server.
+	- HTTPSMSProvider posts an SMSMessage to an SMS gateway.
+	- WebhookProvider posts any message as JSON to a URL.
+
+	A Router picks the provider from the concrete type of the message.
+	Providers are registered with Register, a generic function, so adding
+	a channel is one call and no type switch has to change:
+
+		router := NewRouter()
+		relay, _ := mailer.NewRelay(mailer.RelayConfig{Addr: "localhost:25"})
+		Register(router, "email", NewSMTPProvider(relay))
+		Register(router, "sms", NewHTTPSMSProvider("http://sms.local/messages", 5*time.Second))
+		result, err := router.Send(ctx, mailMessage{...})
+
+	Every delivery returns a DeliveryResult with the channel, the provider,
+	the id of the message and its status.
+
+	Messages sent on behalf of an account (mailMessage, SMSMessage) are
+	refused while the account is suspended (see errors.SuspendAccount),
+	whatever provider would deliver them. Messages sent to a phone number
+	(SMSMessage) are refused when the number is in the OptOutList of the
+	router (see SetOptOuts).
+*/
+
+var (
+	ErrNoProvider     = errors.New("no provider for message type")
+	ErrProviderFailed = errors.New("provider failed to deliver the message")
+)
+
+type DeliveryStatus string
+
+const (
+	StatusSent   DeliveryStatus = "sent"
+	StatusQueued DeliveryStatus = "queued"
+	StatusFailed DeliveryStatus = "failed"
+	// StatusDelivered and StatusExpired come with the delivery receipts of SMS gateways.
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusExpired   DeliveryStatus = "expired"
+)
+
+type DeliveryResult struct {
+	Channel   string         `json:"channel"`
+	Provider  string         `json:"provider"`
+	MessageID string         `json:"message_id"`
+	Status    DeliveryStatus `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	At        time.Time      `json:"at"`
+}
+
+// Provider delivers the messages of one concrete type M.
+type Provider[M message] interface {
+	Name() string
+	Deliver(ctx context.Context, msg M) (DeliveryResult, error)
+}
+
+// sentByAccount is implemented by the messages sent on behalf of an account.
+type sentByAccount interface {
+	senderAccount() string
+}
+
+// sentToPhoneNumber is implemented by the messages that go to a phone number.
+type sentToPhoneNumber interface {
+	recipientPhoneNumber() int
+}
+
+type route struct {
+	channel string
+	deliver func(ctx context.Context, msg message) (DeliveryResult, error)
+}
+
+type Router struct {
+	mu       *sync.RWMutex
+	routes   map[reflect.Type]route
+	fallback *route
+	optOuts  *OptOutList
+}
+
+func NewRouter() *Router {
+	return &Router{
+		mu:     &sync.RWMutex{},
+		routes: map[reflect.Type]route{},
+	}
+}
+
+// Register routes every message of type M to provider, it replaces the previous provider of M.
+func Register[M message](r *Router, channel string, provider Provider[M]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[reflect.TypeFor[M]()] = route{
+		channel: channel,
+		deliver: func(ctx context.Context, msg message) (DeliveryResult, error) {
+			return provider.Deliver(ctx, msg.(M))
+		},
+	}
+}
+
+// SetFallback routes the messages without a provider of their own to provider.
+func (r *Router) SetFallback(channel string, provider Provider[message]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = &route{channel: channel, deliver: provider.Deliver}
+}
+
+// SetOptOuts refuses the messages to the numbers in optOuts, use the list of the SMSInbound.
+func (r *Router) SetOptOuts(optOuts *OptOutList) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.optOuts = optOuts
+}
+
+// Send delivers msg with the provider registered for its type.
+func (r *Router) Send(ctx context.Context, msg message) (DeliveryResult, error) {
+	r.mu.RLock()
+	optOuts := r.optOuts
+	rt, ok := r.routes[reflect.TypeOf(msg)]
+	if !ok && r.fallback != nil {
+		rt, ok = *r.fallback, true
+	}
+	r.mu.RUnlock()
+
+	if m, ok := msg.(sentByAccount); ok {
+		if err := mailerrors.CanSendMsg(m.senderAccount()); err != nil {
+			return DeliveryResult{Status: StatusFailed, Detail: err.Error(), At: time.Now()}, err
+		}
+	}
+	if m, ok := msg.(sentToPhoneNumber); ok && optOuts != nil {
+		if optOuts.isOptedOut(phoneNumberKey(m.recipientPhoneNumber())) {
+			return DeliveryResult{Status: StatusFailed, Detail: ErrOptedOut.Error(), At: time.Now()}, ErrOptedOut
+		}
+	}
+	if !ok {
+		return DeliveryResult{}, fmt.Errorf("%w: %T", ErrNoProvider, msg)
+	}
+	result, err := rt.deliver(ctx, msg)
+	result.Channel = rt.channel
+	if result.At.IsZero() {
+		result.At = time.Now()
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Detail = err.Error()
+	}
+	return result, err
+}
+
+// DefaultRouter is used by SendMail and SendSMS. Out of the box it prints
+// every message, like sendMessage does, register real providers on it to deliver them.
+var DefaultRouter = newConsoleRouter()
+
+func newConsoleRouter() *Router {
+	r := NewRouter()
+	r.SetFallback("console", consoleProvider{})
+	return r
+}
+
+// consoleProvider prints the message with sendMessage.
+type consoleProvider struct{}
+
+func (consoleProvider) Name() string { return "console" }
+
+func (consoleProvider) Deliver(ctx context.Context, msg message) (DeliveryResult, error) {
+	sendMessage(msg)
+	return DeliveryResult{Provider: "console", MessageID: newMessageID(), Status: StatusSent}, nil
+}
+
+// --- SMTP ---
+
+// SMTPProvider delivers mail through an SMTP relay (see the mailer package).
+type SMTPProvider struct {
+	relay *mailer.Relay
+}
+
+func NewSMTPProvider(relay *mailer.Relay) SMTPProvider {
+	return SMTPProvider{relay: relay}
+}
+
+func (p SMTPProvider) Name() string { return "smtp" }
+
+func (p SMTPProvider) Deliver(ctx context.Context, msg mailMessage) (DeliveryResult, error) {
+	result := DeliveryResult{Provider: p.Name()}
+	email := &mailer.Message{
+		From:    msg.sender,
+		To:      []string{msg.recipient},
+		Subject: msg.subject,
+		Body:    msg.body,
+	}
+	if err := p.relay.Send(ctx, email); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrProviderFailed, err)
+	}
+	result.MessageID = email.MessageID
+	result.At = email.Date
+	result.Status = StatusSent
+	return result, nil
+}
+
+// --- SMS over HTTP ---
+
+type HTTPSMSProvider struct {
+	endpoint    string
+	callbackURL string
+	client      *http.Client
+}
+
+// NewHTTPSMSProvider posts the messages to endpoint as {"to": ..., "body": ..., "encoding": ..., "segments": ...}.
+func NewHTTPSMSProvider(endpoint string, timeout time.Duration) HTTPSMSProvider {
+	return HTTPSMSProvider{endpoint: endpoint, client: &http.Client{Timeout: timeout}}
+}
+
+// WithCallback asks the gateway to post the delivery receipts to url (see SMSOutbox.ReceiptHandler).
+func (p HTTPSMSProvider) WithCallback(url string) HTTPSMSProvider {
+	p.callbackURL = url
+	return p
+}
+
+func (p HTTPSMSProvider) Name() string { return "http-sms" }
+
+func (p HTTPSMSProvider) Deliver(ctx context.Context, msg SMSMessage) (DeliveryResult, error) {
+	result := DeliveryResult{Provider: p.Name()}
+	segments, err := msg.segments()
+	if err != nil {
+		return result, err
+	}
+	payload := map[string]any{
+		"to":       msg.phoneNumber,
+		"body":     msg.body,
+		"encoding": segments.encoding,
+		"segments": segments.count(),
+	}
+	if p.callbackURL != "" {
+		payload["callback_url"] = p.callbackURL
+	}
+	var response struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := postJSON(ctx, p.client, p.endpoint, payload, &response); err != nil {
+		return result, err
+	}
+	result.MessageID = response.ID
+	result.Status = StatusQueued
+	if response.Status == string(StatusSent) {
+		result.Status = StatusSent
+	}
+	return result, nil
+}
+
+// --- Webhook ---
+
+// WebhookProvider posts any message to a URL, it's a good fallback for new channels.
+type WebhookProvider[M message] struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookProvider[M message](url string, timeout time.Duration) WebhookProvider[M] {
+	return WebhookProvider[M]{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (p WebhookProvider[M]) Name() string { return "webhook" }
+
+func (p WebhookProvider[M]) Deliver(ctx context.Context, msg M) (DeliveryResult, error) {
+	result := DeliveryResult{Provider: p.Name(), MessageID: newMessageID()}
+	payload := map[string]any{
+		"id":      result.MessageID,
+		"type":    fmt.Sprintf("%T", msg),
+		"message": msg.getMessage(),
+	}
+	if err := postJSON(ctx, p.client, p.url, payload, nil); err != nil {
+		return result, err
+	}
+	result.Status = StatusSent
+	return result, nil
+}
+
+// postJSON posts payload and decodes the response into out when out is not nil.
+func postJSON(ctx context.Context, client *http.Client, url string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProviderFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s responded %s", ErrProviderFailed, url, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func newMessageID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,223 @@
+package interfaces
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// --- Push Notifications and Webhooks ---
+/*
+
+	Besides emails and SMS we deliver two more kinds of messages, and both
+	are billed like the others:
+
+	- pushNotification goes to a mobile device through a push gateway.
+	APNs and FCM reject payloads over 4KB. It costs a flat price per
+	notification.
+	- webhookCall posts an event to a URL of the customer, signed with
+	HMAC-SHA256 and the secret of that customer (it travels with the call)
+	so they can check it comes from us, and no other customer can forge
+	it. Payloads are limited to 256KB and cost per started KB.
+
+	Subscribed customers pay a lower rate. Both kinds implement message
+	(they go through the Router), sentByAccount (a suspended account can't
+	send them) and expense (they show up in the expense reports).
+*/
+
+var (
+	ErrPayloadTooLarge       = errors.New("payload too large")
+	errInvalidWebhookPayload = errors.New("webhook payload is not valid JSON")
+	errMissingWebhookSecret  = errors.New("webhook call has no signing secret")
+)
+
+const (
+	maxPushPayloadBytes    = 4 << 10
+	maxWebhookPayloadBytes = 256 << 10
+)
+
+type pushNotification struct {
+	// account sends the notification, it is blocked while the account is suspended
+	account      string
+	deviceToken  string
+	title        string
+	body         string
+	data         map[string]string
+	isSubscribed bool
+}
+
+func (p pushNotification) getMessage() string {
+	return fmt.Sprintf("Sending push notification %q to device %s", p.title, p.deviceToken)
+}
+
+func (p pushNotification) senderAccount() string {
+	return p.account
+}
+
+func (p pushNotification) cost() float64 {
+	if !p.isSubscribed {
+		return .02
+	}
+	return .005
+}
+
+// payload is the JSON the push gateway gets, its size is what the limit applies to.
+func (p pushNotification) payload() ([]byte, error) {
+	payload, err := json.Marshal(map[string]any{
+		"to":    p.deviceToken,
+		"title": p.title,
+		"body":  p.body,
+		"data":  p.data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxPushPayloadBytes {
+		return nil, fmt.Errorf("%w: push notification is %d bytes, the limit is %d", ErrPayloadTooLarge, len(payload), maxPushPayloadBytes)
+	}
+	return payload, nil
+}
+
+type webhookCall struct {
+	// account sends the call, it is blocked while the account is suspended
+	account string
+	url     string
+	event   string
+	payload []byte // JSON
+	// secret is the signing secret of the customer that owns url
+	secret       string
+	isSubscribed bool
+}
+
+func (wc webhookCall) getMessage() string {
+	return fmt.Sprintf("Sending webhook %s to %s", wc.event, wc.url)
+}
+
+func (wc webhookCall) senderAccount() string {
+	return wc.account
+}
+
+// cost is charged per started KB of payload, an empty payload pays one KB.
+func (wc webhookCall) cost() float64 {
+	kilobytes := float64(max(1, (len(wc.payload)+1023)/1024))
+	if !wc.isSubscribed {
+		return kilobytes * .01
+	}
+	return kilobytes * .002
+}
+
+func (wc webhookCall) validate() error {
+	if len(wc.payload) > maxWebhookPayloadBytes {
+		return fmt.Errorf("%w: webhook is %d bytes, the limit is %d", ErrPayloadTooLarge, len(wc.payload), maxWebhookPayloadBytes)
+	}
+	if len(wc.payload) > 0 && !json.Valid(wc.payload) {
+		return errInvalidWebhookPayload
+	}
+	if wc.secret == "" {
+		return errMissingWebhookSecret
+	}
+	return nil
+}
+
+func init() {
+	registerExpenseKind(expenseKinds, "push", func(p pushNotification) (string, bool) {
+		return p.deviceToken, p.isSubscribed
+	})
+	registerExpenseKind(expenseKinds, "webhook", func(wc webhookCall) (string, bool) {
+		return wc.url, wc.isSubscribed
+	})
+}
+
+// --- Push provider ---
+
+type PushProvider struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewPushProvider posts the notifications to the push gateway at endpoint.
+func NewPushProvider(endpoint string, timeout time.Duration) PushProvider {
+	return PushProvider{endpoint: endpoint, client: &http.Client{Timeout: timeout}}
+}
+
+func (p PushProvider) Name() string { return "push" }
+
+func (p PushProvider) Deliver(ctx context.Context, msg pushNotification) (DeliveryResult, error) {
+	result := DeliveryResult{Provider: p.Name()}
+	payload, err := msg.payload()
+	if err != nil {
+		return result, err
+	}
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := postJSON(ctx, p.client, p.endpoint, json.RawMessage(payload), &response); err != nil {
+		return result, err
+	}
+	result.MessageID = response.ID
+	result.Status = StatusQueued
+	return result, nil
+}
+
+// --- Webhook call provider ---
+
+// WebhookCallProvider posts every webhookCall to its own URL, with the headers:
+//
+//	X-Mailio-Event: the event
+//	X-Mailio-Delivery: the id of the delivery
+//	X-Mailio-Timestamp: unix seconds
+//	X-Mailio-Signature: hex HMAC-SHA256 of "timestamp.payload" with the secret of the webhookCall
+//
+// The provider has no secret of its own, every customer signs with theirs.
+type WebhookCallProvider struct {
+	client *http.Client
+}
+
+func NewWebhookCallProvider(timeout time.Duration) WebhookCallProvider {
+	return WebhookCallProvider{client: &http.Client{Timeout: timeout}}
+}
+
+func (p WebhookCallProvider) Name() string { return "webhook-call" }
+
+func (p WebhookCallProvider) Deliver(ctx context.Context, msg webhookCall) (DeliveryResult, error) {
+	result := DeliveryResult{Provider: p.Name(), MessageID: newMessageID()}
+	if err := msg.validate(); err != nil {
+		return result, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.url, bytes.NewReader(msg.payload))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Mailio-Event", msg.event)
+	req.Header.Set("X-Mailio-Delivery", result.MessageID)
+	req.Header.Set("X-Mailio-Timestamp", timestamp)
+	req.Header.Set("X-Mailio-Signature", signWebhook(msg.secret, timestamp, msg.payload))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", ErrProviderFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, fmt.Errorf("%w: %s responded %s", ErrProviderFailed, msg.url, resp.Status)
+	}
+	result.Status = StatusDelivered
+	return result, nil
+}
+
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
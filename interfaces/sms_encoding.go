@@ -0,0 +1,159 @@
+package interfaces
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode/utf16"
+)
+
+// --- SMS Encoding and Segments ---
+/*
+
+	Carriers don't bill SMS per character, they bill per segment:
+
+	- When every character is in the GSM-7 alphabet a segment holds 160
+	characters. Some characters ({ } [ ] ~ \ | ^ €) take two.
+	- Otherwise (emojis, accents like á, Chinese...) the message is UCS-2
+	and a segment holds only 70 characters. Emojis take two.
+	- Longer messages are split in parts, every part starts with a User
+	Data Header (UDH) that tells the phone how to put them back together.
+	The UDH takes space, so a part holds 153 GSM-7 or 67 UCS-2 characters.
+
+	A character that takes two units is never split between two parts.
+
+	All the parts of a message share a reference in their UDH, every
+	message gets the next one (nextSMSReference), so the phone doesn't mix
+	the parts of two messages that arrive at the same time. The part count
+	of the UDH is one byte: a message can't have more than 255 parts.
+*/
+
+var ErrSMSTooLong = errors.New("sms too long")
+
+const maxSMSParts = 255
+
+// smsReferences is the counter behind nextSMSReference.
+var smsReferences atomic.Uint32
+
+// nextSMSReference returns the concatenation reference of a new message.
+// It is 8 bits, it wraps after 256 messages.
+func nextSMSReference() byte {
+	return byte(smsReferences.Add(1))
+}
+
+type smsEncoding string
+
+const (
+	encodingGSM7 smsEncoding = "GSM-7"
+	encodingUCS2 smsEncoding = "UCS-2"
+)
+
+const (
+	gsm7SingleLimit = 160
+	gsm7PartLimit   = 153
+	ucs2SingleLimit = 70
+	ucs2PartLimit   = 67
+)
+
+// gsm7Basic is the GSM 03.38 basic alphabet, gsm7Extended the characters that need an escape (two septets).
+const (
+	gsm7Basic    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "\f^{}\\[~]|€"
+)
+
+type smsSegment struct {
+	text string
+	// udh is the concatenation header, empty when the message fits in one segment.
+	udh []byte
+}
+
+type smsSegmentation struct {
+	encoding smsEncoding
+	segments []smsSegment
+}
+
+func (ss smsSegmentation) count() int {
+	return len(ss.segments)
+}
+
+// detectEncoding returns GSM-7 when every character of body is in the GSM-7 alphabet.
+func detectEncoding(body string) smsEncoding {
+	for _, r := range body {
+		if !strings.ContainsRune(gsm7Basic, r) && !strings.ContainsRune(gsm7Extended, r) {
+			return encodingUCS2
+		}
+	}
+	return encodingGSM7
+}
+
+// units returns the space a character takes: septets in GSM-7, UTF-16 code units in UCS-2.
+func units(r rune, encoding smsEncoding) int {
+	if encoding == encodingGSM7 {
+		if strings.ContainsRune(gsm7Extended, r) {
+			return 2
+		}
+		return 1
+	}
+	return len(utf16.Encode([]rune{r}))
+}
+
+// countSegments returns the number of segments needed to send body.
+func countSegments(body string) int {
+	_, texts := splitTexts(body)
+	return len(texts)
+}
+
+// splitSMS splits body in the segments it is sent as, reference identifies
+// the message in the UDH of its parts (all the parts of a message share it).
+func splitSMS(body string, reference byte) (smsSegmentation, error) {
+	encoding, texts := splitTexts(body)
+	if len(texts) == 1 {
+		return smsSegmentation{encoding: encoding, segments: []smsSegment{{text: texts[0]}}}, nil
+	}
+	if len(texts) > maxSMSParts {
+		return smsSegmentation{}, fmt.Errorf("%w: %d parts, the limit is %d", ErrSMSTooLong, len(texts), maxSMSParts)
+	}
+	segments := make([]smsSegment, 0, len(texts))
+	for i, text := range texts {
+		segments = append(segments, smsSegment{
+			text: text,
+			// length of the header, IE "concatenated SMS 8-bit reference", IE length, reference, parts, part number
+			udh: []byte{0x05, 0x00, 0x03, reference, byte(len(texts)), byte(i + 1)},
+		})
+	}
+	return smsSegmentation{encoding: encoding, segments: segments}, nil
+}
+
+// splitTexts returns the encoding of body and the text of every segment.
+func splitTexts(body string) (smsEncoding, []string) {
+	encoding := detectEncoding(body)
+	single, part := gsm7SingleLimit, gsm7PartLimit
+	if encoding == encodingUCS2 {
+		single, part = ucs2SingleLimit, ucs2PartLimit
+	}
+
+	total := 0
+	for _, r := range body {
+		total += units(r, encoding)
+	}
+	if total <= single {
+		return encoding, []string{body}
+	}
+
+	var texts []string
+	var current strings.Builder
+	used := 0
+	for _, r := range body {
+		u := units(r, encoding)
+		if used+u > part {
+			texts = append(texts, current.String())
+			current.Reset()
+			used = 0
+		}
+		current.WriteRune(r)
+		used += u
+	}
+	texts = append(texts, current.String())
+	return encoding, texts
+}
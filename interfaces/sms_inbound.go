@@ -0,0 +1,202 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Inbound SMS ---
+/*
+
+	People answer our SMS. The gateway posts every reply to a webhook:
+
+		POST {"id": "...", "from": "+15550001111", "body": "STOP", "at": "..."}
+
+	Some replies are keywords that every SMS sender must honour:
+
+	- STOP or UNSUBSCRIBE: the number opts out, we must not text it again.
+	- START: the number opts back in.
+	- HELP: we answer with a help message.
+
+	Keywords are case insensitive and must be the whole message
+	("stop" is a keyword, "please stop by the office" is not). Every other
+	reply goes to the conversation thread of the number, so somebody can
+	read it and answer.
+
+	Subscription applies the opt-out state to an sms expense (isSubscribed).
+
+	The opt-outs are kept in an OptOutList (see phone_number.go). Give the
+	same list to the Router (Router.SetOptOuts) and it refuses to text an
+	opted-out number with ErrOptedOut, the confirmation of the STOP itself
+	is the last SMS the number gets.
+*/
+
+var (
+	ErrEmptyInboundSMS = errors.New("inbound sms needs from and body")
+	// ErrOptedOut is returned when we try to text a number that replied STOP.
+	ErrOptedOut = errors.New("phone number opted out of sms")
+)
+
+type smsKeywordAction string
+
+const (
+	actionOptOut smsKeywordAction = "opt_out"
+	actionOptIn  smsKeywordAction = "opt_in"
+	actionHelp   smsKeywordAction = "help"
+	actionThread smsKeywordAction = "thread"
+)
+
+var smsKeywords = map[string]smsKeywordAction{
+	"STOP":        actionOptOut,
+	"UNSUBSCRIBE": actionOptOut,
+	"START":       actionOptIn,
+	"HELP":        actionHelp,
+}
+
+const (
+	optOutReply = "You have been unsubscribed from Mailio messages. Reply START to subscribe again."
+	optInReply  = "You are subscribed to Mailio messages again. Reply STOP to unsubscribe."
+	helpReply   = "Mailio: reply STOP to unsubscribe, START to subscribe again. Support: support@mailio.com"
+)
+
+type InboundSMS struct {
+	ID   string    `json:"id"`
+	From string    `json:"from"`
+	Body string    `json:"body"`
+	At   time.Time `json:"at"`
+}
+
+type threadMessage struct {
+	inbound bool
+	body    string
+	at      time.Time
+}
+
+type SMSInbound struct {
+	mu      *sync.Mutex
+	optOuts *OptOutList
+	threads map[string][]threadMessage // by normalized number
+	// reply sends the automatic answers to keywords, nil sends nothing
+	reply func(phoneNumber, body string) error
+	now   func() time.Time
+}
+
+func NewSMSInbound(optOuts *OptOutList, reply func(phoneNumber, body string) error) *SMSInbound {
+	return &SMSInbound{
+		mu:      &sync.Mutex{},
+		optOuts: optOuts,
+		threads: map[string][]threadMessage{},
+		reply:   reply,
+		now:     time.Now,
+	}
+}
+
+// Receive handles one inbound SMS and returns what was done with it.
+// reply gets the normalized number of the sender.
+func (in *SMSInbound) Receive(msg InboundSMS) (smsKeywordAction, error) {
+	if strings.TrimSpace(msg.From) == "" || strings.TrimSpace(msg.Body) == "" {
+		return "", ErrEmptyInboundSMS
+	}
+	from, err := normalizePhoneNumber(msg.From)
+	if err != nil {
+		return "", err
+	}
+	if msg.At.IsZero() {
+		msg.At = in.now()
+	}
+	action, ok := smsKeywords[strings.ToUpper(strings.TrimSpace(msg.Body))]
+	if !ok {
+		action = actionThread
+	}
+
+	var answer string
+	switch action {
+	case actionOptOut:
+		answer = optOutReply
+		// the number opts out after the confirmation, or the confirmation would be refused
+		defer in.optOuts.optOut(from)
+	case actionOptIn:
+		in.optOuts.optIn(from)
+		answer = optInReply
+	case actionHelp:
+		answer = helpReply
+	case actionThread:
+		in.mu.Lock()
+		in.threads[from] = append(in.threads[from], threadMessage{inbound: true, body: msg.Body, at: msg.At})
+		in.mu.Unlock()
+	}
+
+	// the reply goes out without the lock, it may take a while
+	if answer != "" && in.reply != nil {
+		if err := in.reply(from, answer); err != nil {
+			return action, err
+		}
+	}
+	return action, nil
+}
+
+// Answer sends body to phoneNumber as part of its conversation thread.
+func (in *SMSInbound) Answer(phoneNumber, body string) error {
+	phoneNumber, err := normalizePhoneNumber(phoneNumber)
+	if err != nil {
+		return err
+	}
+	if in.optOuts.isOptedOut(phoneNumber) {
+		return ErrOptedOut
+	}
+	if in.reply != nil {
+		if err := in.reply(phoneNumber, body); err != nil {
+			return err
+		}
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.threads[phoneNumber] = append(in.threads[phoneNumber], threadMessage{body: body, at: in.now()})
+	return nil
+}
+
+func (in *SMSInbound) IsSubscribed(phoneNumber string) bool {
+	number, err := normalizePhoneNumber(phoneNumber)
+	return err != nil || !in.optOuts.isOptedOut(number)
+}
+
+// Subscription returns s with isSubscribed set from the opt-out state of its number.
+func (in *SMSInbound) Subscription(s sms) sms {
+	s.isSubscribed = in.IsSubscribed(s.toPhoneNumber)
+	return s
+}
+
+// Thread returns the conversation with phoneNumber, the oldest message first.
+func (in *SMSInbound) Thread(phoneNumber string) []threadMessage {
+	phoneNumber, _ = normalizePhoneNumber(phoneNumber)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return append([]threadMessage(nil), in.threads[phoneNumber]...)
+}
+
+// WebhookHandler is the endpoint the gateway posts the replies to.
+func (in *SMSInbound) WebhookHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var msg InboundSMS
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		action, err := in.Receive(msg)
+		if errors.Is(err, ErrEmptyInboundSMS) || errors.Is(err, ErrInvalidPhoneNumber) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		// a failed automatic reply is not the gateway's problem, the reply was received
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"action": string(action)})
+	})
+}
@@ -0,0 +1,150 @@
+package interfaces
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- Mock SMS Gateway ---
+/*
+
+	MockSMSGateway is a local SMS gateway for tests and development, it
+	speaks the protocol of HTTPSMSProvider:
+
+	- POST /messages {"to", "body", "encoding", "segments", "callback_url"}
+	answers 202 {"id": "sms_1", "status": "queued"}.
+	- After ReceiptDelay it posts a receipt {"id", "status", "at"} to the
+	callback_url of the message. Messages are delivered, unless
+	SetOutcome says otherwise for their phone number.
+
+	Nothing is sent to a real phone.
+*/
+
+type SMSSubmission struct {
+	ID          string `json:"id"`
+	To          int    `json:"to"`
+	Body        string `json:"body"`
+	Encoding    string `json:"encoding"`
+	Segments    int    `json:"segments"`
+	CallbackURL string `json:"callback_url"`
+}
+
+type MockSMSGateway struct {
+	mu           *sync.Mutex
+	receiptDelay time.Duration
+	outcomes     map[int]DeliveryStatus
+	submissions  []SMSSubmission
+	nextID       int
+	client       *http.Client
+	pending      *sync.WaitGroup
+}
+
+func NewMockSMSGateway(receiptDelay time.Duration) *MockSMSGateway {
+	return &MockSMSGateway{
+		mu:           &sync.Mutex{},
+		receiptDelay: receiptDelay,
+		outcomes:     map[int]DeliveryStatus{},
+		client:       &http.Client{Timeout: 5 * time.Second},
+		pending:      &sync.WaitGroup{},
+	}
+}
+
+// SetOutcome sets the receipt status of the messages sent to phoneNumber (delivered, failed or expired).
+func (g *MockSMSGateway) SetOutcome(phoneNumber int, status DeliveryStatus) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.outcomes[phoneNumber] = status
+}
+
+func (g *MockSMSGateway) Submissions() []SMSSubmission {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]SMSSubmission(nil), g.submissions...)
+}
+
+// Start serves the gateway on addr (for example "127.0.0.1:0") and returns its base URL.
+// shutdown waits for the receipts that are still pending.
+func (g *MockSMSGateway) Start(addr string) (baseURL string, shutdown func(context.Context) error, err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: g}
+	go server.Serve(listener)
+	shutdown = func(ctx context.Context) error {
+		if err := server.Shutdown(ctx); err != nil {
+			return err
+		}
+		done := make(chan struct{})
+		go func() {
+			g.pending.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return "http://" + listener.Addr().String(), shutdown, nil
+}
+
+func (g *MockSMSGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/messages" {
+		http.NotFound(w, r)
+		return
+	}
+	var sub SMSSubmission
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sub.To <= 0 || sub.Body == "" {
+		http.Error(w, "to and body are required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	g.mu.Lock()
+	g.nextID++
+	sub.ID = fmt.Sprintf("sms_%d", g.nextID)
+	g.submissions = append(g.submissions, sub)
+	outcome, ok := g.outcomes[sub.To]
+	if !ok {
+		outcome = StatusDelivered
+	}
+	g.mu.Unlock()
+
+	if sub.CallbackURL != "" {
+		g.pending.Add(1)
+		time.AfterFunc(g.receiptDelay, func() {
+			defer g.pending.Done()
+			g.postReceipt(sub.CallbackURL, SMSReceipt{ID: sub.ID, Status: outcome, At: time.Now()})
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"id": sub.ID, "status": string(StatusQueued)})
+}
+
+// postReceipt is best effort, like real gateways a receipt nobody accepts is lost.
+func (g *MockSMSGateway) postReceipt(url string, receipt SMSReceipt) {
+	if receipt.Status != StatusDelivered {
+		receipt.Error = fmt.Sprintf("message %s", receipt.Status)
+	}
+	body, err := json.Marshal(receipt)
+	if err != nil {
+		return
+	}
+	resp, err := g.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
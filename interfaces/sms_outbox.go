@@ -0,0 +1,126 @@
+package interfaces
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- SMS Outbox ---
+/*
+
+	A gateway accepts an SMS right away, but the phone gets it (or not)
+	later. The gateway tells us with a delivery receipt that it posts to
+	our callback URL.
+
+	SMSOutbox is a Provider[SMSMessage] that sends through another provider
+	and keeps every SMSMessage it sent with its id and status. Its
+	ReceiptHandler receives the receipts and updates the status of the
+	message: queued -> delivered, failed or expired.
+*/
+
+var (
+	ErrUnknownSMS           = errors.New("unknown sms id")
+	ErrInvalidReceiptStatus = errors.New("invalid receipt status")
+)
+
+// SMSReceipt is the body of a delivery receipt.
+type SMSReceipt struct {
+	ID     string         `json:"id"`
+	Status DeliveryStatus `json:"status"`
+	At     time.Time      `json:"at"`
+	Error  string         `json:"error,omitempty"`
+}
+
+type SMSOutbox struct {
+	mu       *sync.Mutex
+	provider Provider[SMSMessage]
+	messages map[string]SMSMessage
+	receipts map[string][]SMSReceipt
+}
+
+func NewSMSOutbox(provider Provider[SMSMessage]) *SMSOutbox {
+	return &SMSOutbox{
+		mu:       &sync.Mutex{},
+		provider: provider,
+		messages: map[string]SMSMessage{},
+		receipts: map[string][]SMSReceipt{},
+	}
+}
+
+func (o *SMSOutbox) Name() string { return "outbox+" + o.provider.Name() }
+
+func (o *SMSOutbox) Deliver(ctx context.Context, msg SMSMessage) (DeliveryResult, error) {
+	result, err := o.provider.Deliver(ctx, msg)
+	if err != nil {
+		return result, err
+	}
+	msg.id, msg.status = result.MessageID, result.Status
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// the receipt may arrive before we get here, it wins
+	if receipts := o.receipts[msg.id]; len(receipts) > 0 {
+		msg.status = receipts[len(receipts)-1].Status
+	}
+	o.messages[msg.id] = msg
+	return result, nil
+}
+
+// Message returns the message sent with id and its current status.
+func (o *SMSOutbox) Message(id string) (SMSMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg, ok := o.messages[id]
+	if !ok {
+		return SMSMessage{}, ErrUnknownSMS
+	}
+	return msg, nil
+}
+
+// Receipts returns the receipts of the message, the oldest first.
+func (o *SMSOutbox) Receipts(id string) []SMSReceipt {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]SMSReceipt(nil), o.receipts[id]...)
+}
+
+// Receive applies a delivery receipt to its message.
+func (o *SMSOutbox) Receive(receipt SMSReceipt) error {
+	switch receipt.Status {
+	case StatusDelivered, StatusFailed, StatusExpired:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidReceiptStatus, receipt.Status)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.receipts[receipt.ID] = append(o.receipts[receipt.ID], receipt)
+	if msg, ok := o.messages[receipt.ID]; ok {
+		msg.status = receipt.Status
+		o.messages[receipt.ID] = msg
+	}
+	return nil
+}
+
+// ReceiptHandler is the callback endpoint of the gateway.
+func (o *SMSOutbox) ReceiptHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var receipt SMSReceipt
+		if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := o.Receive(receipt); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"errors"
+	"net/smtp"
+	"strings"
+)
+
+// --- Authentication ---
+/*
+
+	net/smtp only has PLAIN and CRAM-MD5, many relays (Office 365, old
+	Exchange servers) only speak LOGIN. LOGIN sends the username and the
+	password base64 encoded, one per challenge.
+
+	Like PLAIN, LOGIN refuses to send the password over a connection that
+	is not encrypted, unless the server is localhost.
+*/
+
+type AuthMechanism string
+
+const (
+	AuthNone  AuthMechanism = ""
+	AuthPlain AuthMechanism = "PLAIN"
+	AuthLogin AuthMechanism = "LOGIN"
+)
+
+var (
+	ErrUnencryptedAuth   = errors.New("refusing to authenticate over an unencrypted connection")
+	ErrAuthNotSupported  = errors.New("server does not support the auth mechanism")
+	ErrUnexpectedAuthMsg = errors.New("unexpected server challenge")
+)
+
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// LoginAuth returns an smtp.Auth for the LOGIN mechanism.
+func LoginAuth(username, password, host string) smtp.Auth {
+	return &loginAuth{username: username, password: password, host: host}
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, ErrUnencryptedAuth
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return string(AuthLogin), nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSuffix(string(fromServer), ":")) {
+	case "username", "user name":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	}
+	return nil, ErrUnexpectedAuthMsg
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,235 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Inbox ---
+/*
+
+	The Inbox keeps every message the Receiver (see receiver.go) accepts,
+	parsed into a ReceivedMessage: envelope, headers, decoded subject and
+	body, and the raw message.
+
+	It has an HTTP/JSON API, so tests and developers can see what Mailio sent:
+
+		GET    /messages            list the messages (?to=someone@mailio.com filters them)
+		GET    /messages/{id}       one message
+		GET    /messages/{id}/raw   the message as it was received
+		DELETE /messages            delete every message
+
+	An Inbox is safe for concurrent use.
+*/
+
+var ErrMessageNotFound = errors.New("message not found")
+
+type ReceivedMessage struct {
+	ID int `json:"id"`
+	// EnvelopeFrom and EnvelopeTo are the MAIL FROM and RCPT TO addresses,
+	// Bcc recipients are only here.
+	EnvelopeFrom string              `json:"envelope_from"`
+	EnvelopeTo   []string            `json:"envelope_to"`
+	From         string              `json:"from"`
+	To           []string            `json:"to"`
+	Cc           []string            `json:"cc,omitempty"`
+	Subject      string              `json:"subject"`
+	MessageID    string              `json:"message_id"`
+	Date         time.Time           `json:"date"`
+	Headers      map[string][]string `json:"headers"`
+	Body         string              `json:"body"`
+	Raw          string              `json:"-"`
+	ReceivedAt   time.Time           `json:"received_at"`
+}
+
+type Inbox struct {
+	mu       *sync.Mutex
+	messages []ReceivedMessage
+	nextID   int
+	now      func() time.Time
+}
+
+func NewInbox() *Inbox {
+	return &Inbox{mu: &sync.Mutex{}, nextID: 1, now: time.Now}
+}
+
+// Add parses raw and stores it with its envelope.
+func (in *Inbox) Add(envelopeFrom string, envelopeTo []string, raw []byte) (ReceivedMessage, error) {
+	msg, err := parseMessage(raw)
+	if err != nil {
+		return ReceivedMessage{}, err
+	}
+	msg.EnvelopeFrom = envelopeFrom
+	msg.EnvelopeTo = append([]string(nil), envelopeTo...)
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	msg.ID = in.nextID
+	msg.ReceivedAt = in.now()
+	in.nextID++
+	in.messages = append(in.messages, msg)
+	return msg, nil
+}
+
+// List returns the messages in the order they arrived,
+// only the ones sent to recipient when it is not empty.
+func (in *Inbox) List(recipient string) []ReceivedMessage {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	var list []ReceivedMessage
+	for _, msg := range in.messages {
+		if recipient == "" || containsAddress(msg.EnvelopeTo, recipient) {
+			list = append(list, msg)
+		}
+	}
+	return list
+}
+
+func (in *Inbox) Get(id int) (ReceivedMessage, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, msg := range in.messages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return ReceivedMessage{}, ErrMessageNotFound
+}
+
+func (in *Inbox) Clear() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.messages = nil
+}
+
+// Handler returns the HTTP/JSON API of the inbox.
+func (in *Inbox) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /messages", func(w http.ResponseWriter, r *http.Request) {
+		list := in.List(r.URL.Query().Get("to"))
+		if list == nil {
+			list = []ReceivedMessage{}
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+	mux.HandleFunc("GET /messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if msg, ok := in.lookup(w, r); ok {
+			writeJSON(w, http.StatusOK, msg)
+		}
+	})
+	mux.HandleFunc("GET /messages/{id}/raw", func(w http.ResponseWriter, r *http.Request) {
+		if msg, ok := in.lookup(w, r); ok {
+			w.Header().Set("Content-Type", "message/rfc822")
+			io.WriteString(w, msg.Raw)
+		}
+	})
+	mux.HandleFunc("DELETE /messages", func(w http.ResponseWriter, r *http.Request) {
+		in.Clear()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// StartHTTP serves the API on addr (for example "127.0.0.1:0") and returns its base URL.
+func (in *Inbox) StartHTTP(addr string) (baseURL string, shutdown func(context.Context) error, err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: in.Handler()}
+	go server.Serve(listener)
+	return "http://" + listener.Addr().String(), server.Shutdown, nil
+}
+
+func (in *Inbox) lookup(w http.ResponseWriter, r *http.Request) (ReceivedMessage, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid message id"})
+		return ReceivedMessage{}, false
+	}
+	msg, err := in.Get(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return ReceivedMessage{}, false
+	}
+	return msg, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// parseMessage reads the headers and decodes the subject and the body.
+func parseMessage(raw []byte) (ReceivedMessage, error) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return ReceivedMessage{}, err
+	}
+	decoder := &mime.WordDecoder{}
+	subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		subject = parsed.Header.Get("Subject")
+	}
+	msg := ReceivedMessage{
+		From:      parsed.Header.Get("From"),
+		To:        addressList(parsed.Header, "To"),
+		Cc:        addressList(parsed.Header, "Cc"),
+		Subject:   subject,
+		MessageID: strings.Trim(parsed.Header.Get("Message-ID"), "<>"),
+		Headers:   parsed.Header,
+		Raw:       string(raw),
+	}
+	if date, err := parsed.Header.Date(); err == nil {
+		msg.Date = date
+	}
+
+	var body io.Reader = parsed.Body
+	switch strings.ToLower(parsed.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	decoded, err := io.ReadAll(body)
+	if err != nil {
+		return ReceivedMessage{}, err
+	}
+	msg.Body = strings.ReplaceAll(string(decoded), "\r\n", "\n")
+	return msg, nil
+}
+
+func addressList(header mail.Header, name string) []string {
+	list, err := header.AddressList(name)
+	if err != nil {
+		return nil
+	}
+	addresses := make([]string, 0, len(list))
+	for _, addr := range list {
+		addresses = append(addresses, addr.Address)
+	}
+	return addresses
+}
+
+func containsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if strings.EqualFold(a, address) {
+			return true
+		}
+	}
+	return false
+}
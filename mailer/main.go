@@ -0,0 +1,264 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+// --- SMTP submission ---
+/*
+
+	A Relay sends messages to one SMTP server (our relay, like
+	smtp.mailio.com:587):
+
+	- It says EHLO, upgrades to TLS with STARTTLS when the server offers
+	it (or fails when RequireTLS is set and the server doesn't), and
+	authenticates with PLAIN or LOGIN.
+	- When the server supports PIPELINING, MAIL FROM, every RCPT TO and
+	DATA go in one round trip instead of one round trip per command.
+	- Connections are kept in a pool and reused for the next messages,
+	a connection that fails is thrown away.
+
+	Messages are built with Message.Build (see message.go).
+
+	A Relay is safe for concurrent use.
+*/
+
+var (
+	ErrTLSRequired = errors.New("server does not support STARTTLS")
+	ErrRelayClosed = errors.New("relay is closed")
+)
+
+type RelayConfig struct {
+	// Addr is "host:port".
+	Addr     string
+	Username string
+	Password string
+	// Auth is the mechanism to use, AuthNone skips authentication.
+	Auth AuthMechanism
+	// TLSConfig is used for STARTTLS, a nil config verifies the host of Addr.
+	TLSConfig  *tls.Config
+	RequireTLS bool
+	// LocalName is the name sent with EHLO, "localhost" when empty.
+	LocalName string
+	// MaxIdle is the number of connections kept open between sends.
+	MaxIdle int
+	// IdleTimeout closes the connections that were not used for that long.
+	IdleTimeout time.Duration
+	// DialTimeout bounds the connection and the SMTP greeting.
+	DialTimeout time.Duration
+}
+
+type conn struct {
+	client     *smtp.Client
+	pipelining bool
+	lastUsed   time.Time
+}
+
+type Relay struct {
+	mu     *sync.Mutex
+	config RelayConfig
+	host   string
+	idle   []*conn
+	closed bool
+	now    func() time.Time
+}
+
+func NewRelay(config RelayConfig) (*Relay, error) {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("relay address: %w", err)
+	}
+	if config.MaxIdle <= 0 {
+		config.MaxIdle = 2
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = time.Minute
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 10 * time.Second
+	}
+	if config.LocalName == "" {
+		config.LocalName = "localhost"
+	}
+	return &Relay{mu: &sync.Mutex{}, config: config, host: host, now: time.Now}, nil
+}
+
+// Send delivers msg. A pooled connection that fails is replaced by a new one once.
+func (r *Relay) Send(ctx context.Context, msg *Message) error {
+	from, err := msg.sender()
+	if err != nil {
+		return err
+	}
+	recipients, err := msg.Recipients()
+	if err != nil {
+		return err
+	}
+	data, err := msg.Build()
+	if err != nil {
+		return err
+	}
+
+	c, pooled, err := r.get(ctx)
+	if err != nil {
+		return err
+	}
+	err = r.send(ctx, c, from, recipients, data)
+	if err != nil && pooled && isConnError(err) {
+		// the server closed the idle connection, try again with a new one
+		c.client.Close()
+		if c, err = r.dial(ctx); err != nil {
+			return err
+		}
+		err = r.send(ctx, c, from, recipients, data)
+	}
+	if err != nil {
+		// the server rejected the message, the connection can be reused once the transaction is reset
+		if isConnError(err) || c.client.Reset() != nil {
+			c.client.Close()
+		} else {
+			r.put(c)
+		}
+		return err
+	}
+	r.put(c)
+	return nil
+}
+
+// Close closes the idle connections, the next Send fails with ErrRelayClosed.
+func (r *Relay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	var errs []error
+	for _, c := range r.idle {
+		errs = append(errs, c.client.Quit())
+	}
+	r.idle = nil
+	return errors.Join(errs...)
+}
+
+// get returns an idle connection (pooled is true) or a new one.
+func (r *Relay) get(ctx context.Context) (c *conn, pooled bool, err error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, false, ErrRelayClosed
+	}
+	now := r.now()
+	for len(r.idle) > 0 {
+		c = r.idle[len(r.idle)-1]
+		r.idle = r.idle[:len(r.idle)-1]
+		if now.Sub(c.lastUsed) < r.config.IdleTimeout {
+			r.mu.Unlock()
+			return c, true, nil
+		}
+		c.client.Close()
+	}
+	r.mu.Unlock()
+	c, err = r.dial(ctx)
+	return c, false, err
+}
+
+// put gives the connection back to the pool, or closes it when the pool is full.
+func (r *Relay) put(c *conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || len(r.idle) >= r.config.MaxIdle {
+		c.client.Quit()
+		return
+	}
+	c.lastUsed = r.now()
+	r.idle = append(r.idle, c)
+}
+
+func (r *Relay) dial(ctx context.Context) (*conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.DialTimeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	netConn, err := dialer.DialContext(ctx, "tcp", r.config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(netConn, r.host)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if err := r.handshake(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	pipelining, _ := client.Extension("PIPELINING")
+	return &conn{client: client, pipelining: pipelining}, nil
+}
+
+// handshake says EHLO, starts TLS and authenticates.
+func (r *Relay) handshake(client *smtp.Client) error {
+	if err := client.Hello(r.config.LocalName); err != nil {
+		return err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := r.config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: r.host}
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	} else if r.config.RequireTLS {
+		return ErrTLSRequired
+	}
+
+	var auth smtp.Auth
+	switch r.config.Auth {
+	case AuthNone:
+		return nil
+	case AuthPlain:
+		auth = smtp.PlainAuth("", r.config.Username, r.config.Password, r.host)
+	case AuthLogin:
+		auth = LoginAuth(r.config.Username, r.config.Password, r.host)
+	default:
+		return fmt.Errorf("%w: %s", ErrAuthNotSupported, r.config.Auth)
+	}
+	if ok, mechanisms := client.Extension("AUTH"); !ok || !containsWord(mechanisms, string(r.config.Auth)) {
+		return fmt.Errorf("%w: %s", ErrAuthNotSupported, r.config.Auth)
+	}
+	return client.Auth(auth)
+}
+
+// send runs one mail transaction on c.
+func (r *Relay) send(ctx context.Context, c *conn, from string, recipients []string, data []byte) error {
+	// smtp.Client doesn't take a context, closing the connection stops waiting for the server
+	stop := context.AfterFunc(ctx, func() { c.client.Close() })
+	defer stop()
+	if c.pipelining {
+		return sendPipelined(c.client, from, recipients, data)
+	}
+	if err := c.client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range recipients {
+		if err := c.client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
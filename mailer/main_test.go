@@ -0,0 +1,453 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a small in-process SMTP server for the Relay tests.
+// It keeps every message it gets and checks AUTH with authenticate.
+type smtpStandIn struct {
+	pipelining   bool
+	authenticate func(mechanism AuthMechanism, username, password string) bool
+
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	received []receivedMail
+}
+
+type receivedMail struct {
+	from string
+	to   []string
+	raw  string // with LF line endings
+}
+
+func (rm receivedMail) header(t *testing.T) mail.Header {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(rm.raw))
+	if err != nil {
+		t.Fatalf("parse received message: %v", err)
+	}
+	return msg.Header
+}
+
+// startStandIn runs a stand-in on a free local port, configure changes it before it starts.
+func startStandIn(t *testing.T, configure func(srv *smtpStandIn)) (*smtpStandIn, string) {
+	t.Helper()
+	srv := &smtpStandIn{pipelining: true, conns: map[net.Conn]bool{}}
+	if configure != nil {
+		configure(srv)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.conns[conn] = true
+			srv.mu.Unlock()
+			go func() {
+				srv.handle(conn)
+				srv.mu.Lock()
+				delete(srv.conns, conn)
+				srv.mu.Unlock()
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		srv.dropConnections()
+	})
+	return srv, listener.Addr().String()
+}
+
+func (srv *smtpStandIn) messages() []receivedMail {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]receivedMail(nil), srv.received...)
+}
+
+// dropConnections closes the open connections, like a server that times out idle clients.
+func (srv *smtpStandIn) dropConnections() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for conn := range srv.conns {
+		conn.Close()
+		delete(srv.conns, conn)
+	}
+}
+
+func (srv *smtpStandIn) handle(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	defer text.Close()
+	var from string
+	var to []string
+	text.PrintfLine("220 localhost stand-in ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			ext := []string{"localhost", "AUTH PLAIN LOGIN"}
+			if srv.pipelining {
+				ext = append(ext, "PIPELINING")
+			}
+			for i, e := range ext {
+				sep := "-"
+				if i == len(ext)-1 {
+					sep = " "
+				}
+				text.PrintfLine("250%s%s", sep, e)
+			}
+		case "AUTH":
+			if !srv.auth(text, arg) {
+				return
+			}
+		case "MAIL":
+			from, to = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>"), nil
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if rcpt == "" {
+				text.PrintfLine("501 empty recipient")
+				continue
+			}
+			to = append(to, rcpt)
+			text.PrintfLine("250 ok")
+		case "DATA":
+			if len(to) == 0 {
+				text.PrintfLine("503 need RCPT first")
+				continue
+			}
+			text.PrintfLine("354 go ahead")
+			raw, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.received = append(srv.received, receivedMail{from: from, to: to, raw: string(raw)})
+			srv.mu.Unlock()
+			from, to = "", nil
+			text.PrintfLine("250 ok")
+		case "RSET":
+			from, to = "", nil
+			text.PrintfLine("250 ok")
+		case "NOOP":
+			text.PrintfLine("250 ok")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// auth reads the PLAIN or LOGIN credentials, it returns false when the connection is broken.
+func (srv *smtpStandIn) auth(text *textproto.Conn, arg string) bool {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	readAnswer := func(challenge string) (string, bool) {
+		text.PrintfLine("334 %s", challenge)
+		line, err := text.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		return string(decoded), true
+	}
+	var username, password string
+	switch AuthMechanism(mechanism) {
+	case AuthPlain:
+		decoded, _ := base64.StdEncoding.DecodeString(initial)
+		fields := strings.Split(string(decoded), "\x00")
+		if len(fields) != 3 {
+			text.PrintfLine("501 invalid PLAIN credentials")
+			return true
+		}
+		username, password = fields[1], fields[2]
+	case AuthLogin:
+		var ok bool
+		if username, ok = readAnswer("VXNlcm5hbWU6"); !ok {
+			return false
+		}
+		if password, ok = readAnswer("UGFzc3dvcmQ6"); !ok {
+			return false
+		}
+	default:
+		text.PrintfLine("504 unrecognized authentication type")
+		return true
+	}
+	if srv.authenticate != nil && !srv.authenticate(AuthMechanism(mechanism), username, password) {
+		text.PrintfLine("535 authentication failed")
+		return true
+	}
+	text.PrintfLine("235 authentication successful")
+	return true
+}
+
+func newTestRelay(t *testing.T, config RelayConfig) *Relay {
+	t.Helper()
+	relay, err := NewRelay(config)
+	if err != nil {
+		t.Fatalf("new relay: %v", err)
+	}
+	t.Cleanup(func() { relay.Close() })
+	return relay
+}
+
+func testMessage(subject string) *Message {
+	return &Message{
+		From:    "Mailio <no-reply@mailio.com>",
+		To:      []string{"ana@example.com"},
+		Bcc:     []string{"audit@mailio.com"},
+		Subject: subject,
+		Body:    "Hello Ana",
+	}
+}
+
+func TestRelayAuth(t *testing.T) {
+	tests := []struct {
+		name      string
+		mechanism AuthMechanism
+		password  string
+		wantErr   bool
+	}{
+		{name: "plain", mechanism: AuthPlain, password: "secret"},
+		{name: "login", mechanism: AuthLogin, password: "secret"},
+		{name: "plain wrong password", mechanism: AuthPlain, password: "wrong", wantErr: true},
+		{name: "login wrong password", mechanism: AuthLogin, password: "wrong", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotMechanism AuthMechanism
+			var gotUsername string
+			srv, addr := startStandIn(t, func(srv *smtpStandIn) {
+				srv.authenticate = func(mechanism AuthMechanism, username, password string) bool {
+					gotMechanism, gotUsername = mechanism, username
+					return password == "secret"
+				}
+			})
+			relay := newTestRelay(t, RelayConfig{Addr: addr, Auth: tt.mechanism, Username: "mailio", Password: tt.password})
+
+			err := relay.Send(context.Background(), testMessage("auth"))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Send succeeded with a wrong password")
+				}
+				if n := len(srv.messages()); n != 0 {
+					t.Fatalf("server got %d messages, want 0", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if gotMechanism != tt.mechanism || gotUsername != "mailio" {
+				t.Errorf("server got %s %q, want %s %q", gotMechanism, gotUsername, tt.mechanism, "mailio")
+			}
+			if n := len(srv.messages()); n != 1 {
+				t.Fatalf("server got %d messages, want 1", n)
+			}
+		})
+	}
+}
+
+func TestRelayAuthNotSupported(t *testing.T) {
+	_, addr := startStandIn(t, nil)
+	relay := newTestRelay(t, RelayConfig{Addr: addr, Auth: "CRAM-MD5"})
+	if err := relay.Send(context.Background(), testMessage("auth")); !errors.Is(err, ErrAuthNotSupported) {
+		t.Fatalf("Send error = %v, want ErrAuthNotSupported", err)
+	}
+}
+
+func TestRelayPipelining(t *testing.T) {
+	for _, pipelining := range []bool{true, false} {
+		name := "pipelined"
+		if !pipelining {
+			name = "one command at a time"
+		}
+		t.Run(name, func(t *testing.T) {
+			srv, addr := startStandIn(t, func(srv *smtpStandIn) {
+				srv.pipelining = pipelining
+			})
+			relay := newTestRelay(t, RelayConfig{Addr: addr})
+
+			msg := testMessage("pipelining")
+			msg.Cc = []string{"bob@example.com"}
+			if err := relay.Send(context.Background(), msg); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if len(relay.idle) != 1 || relay.idle[0].pipelining != pipelining {
+				t.Fatalf("pooled connection pipelining = %v, want %v", relay.idle, pipelining)
+			}
+
+			received := srv.messages()
+			if len(received) != 1 {
+				t.Fatalf("server got %d messages, want 1", len(received))
+			}
+			got := received[0]
+			want := []string{"ana@example.com", "bob@example.com", "audit@mailio.com"}
+			if strings.Join(got.to, ",") != strings.Join(want, ",") {
+				t.Errorf("envelope to = %v, want %v", got.to, want)
+			}
+			if got.from != "no-reply@mailio.com" {
+				t.Errorf("envelope from = %q", got.from)
+			}
+			if strings.Contains(got.raw, "audit@mailio.com") {
+				t.Error("the Bcc recipient is in the headers")
+			}
+		})
+	}
+}
+
+func TestRelayPipeliningRejectedRecipient(t *testing.T) {
+	srv, addr := startStandIn(t, nil)
+	relay := newTestRelay(t, RelayConfig{Addr: addr})
+
+	// the relay sends the address as it is parsed, the server rejects the empty one
+	if err := relay.send(context.Background(), mustDial(t, relay), "no-reply@mailio.com", []string{"ana@example.com", ""}, []byte("Subject: x\r\n\r\nbody\r\n")); err == nil {
+		t.Fatal("send succeeded with a rejected recipient")
+	}
+	if n := len(srv.messages()); n != 0 {
+		t.Fatalf("server got %d messages, want 0: a partial transaction was delivered", n)
+	}
+	// the relay still works afterwards
+	if err := relay.Send(context.Background(), testMessage("rejected")); err != nil {
+		t.Fatalf("Send after a rejection: %v", err)
+	}
+}
+
+func mustDial(t *testing.T, relay *Relay) *conn {
+	t.Helper()
+	c, err := relay.dial(context.Background())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { c.client.Close() })
+	return c
+}
+
+func TestRelayPoolReuse(t *testing.T) {
+	srv, addr := startStandIn(t, nil)
+	relay := newTestRelay(t, RelayConfig{Addr: addr})
+
+	if err := relay.Send(context.Background(), testMessage("first")); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	first := relay.idle[0]
+	if err := relay.Send(context.Background(), testMessage("second")); err != nil {
+		t.Fatalf("second Send: %v", err)
+	}
+	if len(relay.idle) != 1 || relay.idle[0] != first {
+		t.Fatal("the second Send didn't reuse the pooled connection")
+	}
+	if n := len(srv.messages()); n != 2 {
+		t.Fatalf("server got %d messages, want 2", n)
+	}
+}
+
+func TestRelayPoolServerDropsIdleConnection(t *testing.T) {
+	srv, addr := startStandIn(t, nil)
+	relay := newTestRelay(t, RelayConfig{Addr: addr})
+
+	if err := relay.Send(context.Background(), testMessage("before")); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	stale := relay.idle[0]
+
+	srv.dropConnections()
+
+	if err := relay.Send(context.Background(), testMessage("after")); err != nil {
+		t.Fatalf("Send after the server dropped the connection: %v", err)
+	}
+	if len(relay.idle) != 1 || relay.idle[0] == stale {
+		t.Fatal("the dropped connection is still in the pool")
+	}
+	received := srv.messages()
+	if len(received) != 2 || received[1].header(t).Get("Subject") != "after" {
+		t.Fatalf("server got %d messages, want the second one delivered", len(received))
+	}
+}
+
+func TestRelayIdleTimeout(t *testing.T) {
+	_, addr := startStandIn(t, nil)
+	relay := newTestRelay(t, RelayConfig{Addr: addr, IdleTimeout: time.Minute})
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	relay.now = func() time.Time { return now }
+
+	if err := relay.Send(context.Background(), testMessage("first")); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	first := relay.idle[0]
+	now = now.Add(2 * time.Minute)
+	if err := relay.Send(context.Background(), testMessage("second")); err != nil {
+		t.Fatalf("second Send: %v", err)
+	}
+	if relay.idle[0] == first {
+		t.Fatal("a connection idle for longer than IdleTimeout was reused")
+	}
+}
+
+func TestRelayDateAndMessageID(t *testing.T) {
+	srv, addr := startStandIn(t, nil)
+	relay := newTestRelay(t, RelayConfig{Addr: addr})
+
+	msg := testMessage("héllo")
+	before := time.Now().Add(-time.Second)
+	if err := relay.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if msg.MessageID == "" || msg.Date.IsZero() {
+		t.Fatalf("Build didn't set Date and Message-ID: %q %v", msg.MessageID, msg.Date)
+	}
+
+	header := srv.messages()[0].header(t)
+	if got := header.Get("Message-ID"); got != "<"+msg.MessageID+">" {
+		t.Errorf("Message-ID = %q, want %q in angle brackets", got, msg.MessageID)
+	}
+	if !strings.HasSuffix(msg.MessageID, "@mailio.com") {
+		t.Errorf("Message-ID %q is not in the domain of the sender", msg.MessageID)
+	}
+	date, err := header.Date()
+	if err != nil {
+		t.Fatalf("Date header: %v", err)
+	}
+	if !date.Equal(msg.Date.Truncate(time.Second)) || date.Before(before) {
+		t.Errorf("Date = %v, want %v", date, msg.Date)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != "héllo" {
+		t.Errorf("Subject = %q (%v), want the encoded subject", subject, err)
+	}
+
+	// headers set by the caller are kept
+	fixed := testMessage("fixed")
+	fixed.MessageID = "fixed@mailio.com"
+	fixed.Date = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := relay.Send(context.Background(), fixed); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	header = srv.messages()[1].header(t)
+	date, _ = header.Date()
+	if header.Get("Message-ID") != "<fixed@mailio.com>" || !date.Equal(fixed.Date) {
+		t.Errorf("got Message-ID %q Date %v, want the ones of the message", header.Get("Message-ID"), date)
+	}
+}
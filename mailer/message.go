@@ -0,0 +1,164 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- RFC 5322 messages ---
+/*
+
+	An email is a list of headers, an empty line and a body, every line
+	ends with CRLF. Build adds the headers every server expects:
+
+	- Date and Message-ID, when the message doesn't have them.
+	- MIME-Version and a UTF-8 text/plain Content-Type.
+	- Subjects that are not ASCII are encoded ("=?utf-8?q?...?=").
+
+	The body is quoted-printable, so long lines and non-ASCII characters
+	are safe. Bcc recipients get the message but are not in the headers.
+*/
+
+var (
+	ErrNoSender     = errors.New("message has no sender")
+	ErrNoRecipients = errors.New("message has no recipients")
+	ErrBadHeader    = errors.New("header contains a line break")
+)
+
+type Message struct {
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	Subject string
+	Body    string
+	// Headers are extra headers, like Reply-To.
+	Headers map[string]string
+	// Date and MessageID are set by Build when they are empty.
+	Date      time.Time
+	MessageID string
+}
+
+// Recipients returns every address the message goes to, Bcc included.
+func (m *Message) Recipients() ([]string, error) {
+	var recipients []string
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, raw := range list {
+			addr, err := mail.ParseAddress(raw)
+			if err != nil {
+				return nil, fmt.Errorf("recipient %q: %w", raw, err)
+			}
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return recipients, nil
+}
+
+// sender returns the address of From, without its display name.
+func (m *Message) sender() (string, error) {
+	if m.From == "" {
+		return "", ErrNoSender
+	}
+	addr, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", fmt.Errorf("sender %q: %w", m.From, err)
+	}
+	return addr.Address, nil
+}
+
+// Build returns the message in the RFC 5322 format.
+func (m *Message) Build() ([]byte, error) {
+	from, err := m.sender()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.Recipients(); err != nil {
+		return nil, err
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		m.MessageID = newMessageID(from)
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) error {
+		if strings.ContainsAny(name, "\r\n:") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%w: %s", ErrBadHeader, name)
+		}
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		return nil
+	}
+
+	headers := [][2]string{
+		{"From", m.From},
+		{"To", strings.Join(m.To, ", ")},
+	}
+	if len(m.Cc) > 0 {
+		headers = append(headers, [2]string{"Cc", strings.Join(m.Cc, ", ")})
+	}
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		[2]string{"Date", m.Date.Format(time.RFC1123Z)},
+		[2]string{"Message-ID", "<" + m.MessageID + ">"},
+		[2]string{"MIME-Version", "1.0"},
+		[2]string{"Content-Type", "text/plain; charset=utf-8"},
+		[2]string{"Content-Transfer-Encoding", "quoted-printable"},
+	)
+	// extra headers sorted, so the same message always builds the same bytes
+	extra := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		headers = append(headers, [2]string{name, m.Headers[name]})
+	}
+	for _, h := range headers {
+		if h[0] == "To" && h[1] == "" {
+			// only Bcc recipients
+			h[1] = "undisclosed-recipients:;"
+		}
+		if err := header(h[0], h[1]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(m.Body, "\r\n", "\n")
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\r\n")) {
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// newMessageID returns "<random>@<domain of the sender>".
+func newMessageID(from string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+	return hex.EncodeToString(b) + "@" + domain
+}
@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+)
+
+// --- Pipelining ---
+/*
+
+	Without pipelining every command waits for its reply:
+
+		MAIL FROM -> 250, RCPT TO -> 250, RCPT TO -> 250, DATA -> 354
+
+	With PIPELINING (RFC 2920) we write all of them and then read the
+	replies in order, one round trip instead of four. When a command fails
+	we keep reading the other replies, so the connection stays in sync,
+	and return the first error.
+*/
+
+func sendPipelined(client *smtp.Client, from string, recipients []string, data []byte) error {
+	text := client.Text
+	ids := make([]uint, 0, len(recipients)+2)
+	id, err := text.Cmd("MAIL FROM:<%s>", from)
+	if err != nil {
+		return err
+	}
+	ids = append(ids, id)
+	for _, rcpt := range recipients {
+		if id, err = text.Cmd("RCPT TO:<%s>", rcpt); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if id, err = text.Cmd("DATA"); err != nil {
+		return err
+	}
+	ids = append(ids, id)
+
+	var firstErr error
+	dataAccepted := false
+	for i, id := range ids {
+		expected := 250
+		if i == len(ids)-1 {
+			expected = 354
+		}
+		text.StartResponse(id)
+		_, _, err := text.ReadResponse(expected)
+		text.EndResponse(id)
+		if err == nil && i == len(ids)-1 {
+			dataAccepted = true
+			continue
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		var protoErr *textproto.Error
+		if err != nil && !errors.As(err, &protoErr) {
+			// the connection is broken, the other replies will never come
+			return err
+		}
+	}
+	if firstErr != nil {
+		if dataAccepted {
+			// the server waits for the message and would deliver even an empty one
+			// to the recipients it accepted, dropping the connection aborts the transaction
+			client.Close()
+		}
+		return firstErr
+	}
+
+	w := text.DotWriter()
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	_, _, err = text.ReadResponse(250)
+	return err
+}
+
+// isConnError is true when err doesn't come from an SMTP reply, so the connection can't be trusted.
+func isConnError(err error) bool {
+	var protoErr *textproto.Error
+	return !errors.As(err, &protoErr)
+}
+
+// containsWord reports whether word is in the space separated list (case insensitive).
+func containsWord(list, word string) bool {
+	for _, w := range strings.Fields(list) {
+		if strings.EqualFold(w, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,345 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// --- Receiver ---
+/*
+
+	The Receiver is a small SMTP server for tests and local development:
+	point a Relay (or any mail client) to it and every message ends up in
+	an Inbox instead of somebody's real mailbox.
+
+		inbox := NewInbox()
+		receiver := NewReceiver(inbox)
+		smtpAddr, shutdown, _ := receiver.Start("127.0.0.1:0")
+		relay, _ := NewRelay(RelayConfig{Addr: smtpAddr})
+
+	It speaks EHLO/HELO, MAIL, RCPT, DATA, RSET, NOOP and QUIT, and it
+	advertises PIPELINING (unless DisablePipelining is set) and 8BITMIME.
+	AUTH PLAIN and LOGIN accept any credentials unless Authenticate is set,
+	and STARTTLS is offered when TLSConfig is set.
+	It never relays anything.
+*/
+
+const defaultMaxMessageBytes = 10 << 20
+
+var errMessageTooBig = errors.New("message too big")
+
+type Receiver struct {
+	inbox    *Inbox
+	hostname string
+	// TLSConfig enables STARTTLS.
+	TLSConfig *tls.Config
+	// MaxMessageBytes rejects bigger messages, 10MB by default.
+	MaxMessageBytes int64
+	// DisablePipelining stops advertising PIPELINING, like many old servers.
+	DisablePipelining bool
+	// Authenticate checks the credentials of AUTH, nil accepts any.
+	Authenticate func(mechanism AuthMechanism, username, password string) bool
+
+	mu       *sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	wg       *sync.WaitGroup
+}
+
+func NewReceiver(inbox *Inbox) *Receiver {
+	return &Receiver{
+		inbox:           inbox,
+		hostname:        "localhost",
+		MaxMessageBytes: defaultMaxMessageBytes,
+		mu:              &sync.Mutex{},
+		conns:           map[net.Conn]bool{},
+		wg:              &sync.WaitGroup{},
+	}
+}
+
+// Start accepts SMTP connections on addr (for example "127.0.0.1:0") and returns the address it listens on.
+// shutdown stops accepting connections and waits for the open ones until ctx is done.
+func (rc *Receiver) Start(addr string) (smtpAddr string, shutdown func(context.Context) error, err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	rc.mu.Lock()
+	rc.listener = listener
+	rc.mu.Unlock()
+	go rc.serve(listener)
+	return listener.Addr().String(), rc.shutdown, nil
+}
+
+func (rc *Receiver) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		rc.mu.Lock()
+		rc.conns[conn] = true
+		rc.mu.Unlock()
+		rc.wg.Add(1)
+		go func() {
+			defer rc.wg.Done()
+			rc.handle(conn)
+			rc.mu.Lock()
+			delete(rc.conns, conn)
+			rc.mu.Unlock()
+		}()
+	}
+}
+
+func (rc *Receiver) shutdown(ctx context.Context) error {
+	rc.mu.Lock()
+	err := rc.listener.Close()
+	rc.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		rc.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		rc.mu.Lock()
+		for conn := range rc.conns {
+			conn.Close()
+		}
+		rc.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// session is the state of one SMTP conversation.
+type session struct {
+	text       *textproto.Conn
+	conn       net.Conn
+	greeted    bool
+	tls        bool
+	from       string
+	hasFrom    bool
+	recipients []string
+}
+
+func (s *session) reset() {
+	s.from, s.hasFrom, s.recipients = "", false, nil
+}
+
+func (s *session) reply(code int, format string, args ...any) error {
+	return s.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+func (rc *Receiver) handle(conn net.Conn) {
+	s := &session{text: textproto.NewConn(conn), conn: conn}
+	defer func() { s.text.Close() }()
+	s.reply(220, "%s Mailio receiver ready", rc.hostname)
+	for {
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			s.greeted = true
+			s.reset()
+			ext := []string{rc.hostname, "8BITMIME", fmt.Sprintf("SIZE %d", rc.MaxMessageBytes), "AUTH PLAIN LOGIN"}
+			if !rc.DisablePipelining {
+				ext = append(ext, "PIPELINING")
+			}
+			if rc.TLSConfig != nil && !s.tls {
+				ext = append(ext, "STARTTLS")
+			}
+			for i, e := range ext {
+				sep := "-"
+				if i == len(ext)-1 {
+					sep = " "
+				}
+				s.text.PrintfLine("250%s%s", sep, e)
+			}
+		case "HELO":
+			s.greeted = true
+			s.reset()
+			s.reply(250, "%s", rc.hostname)
+		case "STARTTLS":
+			if rc.TLSConfig == nil || s.tls {
+				s.reply(502, "STARTTLS not available")
+				continue
+			}
+			s.reply(220, "ready to start TLS")
+			tlsConn := tls.Server(s.conn, rc.TLSConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			// the client says EHLO again over TLS
+			s.text = textproto.NewConn(tlsConn)
+			s.conn = tlsConn
+			s.tls, s.greeted = true, false
+			s.reset()
+		case "AUTH":
+			rc.auth(s, arg)
+		case "MAIL":
+			rc.mail(s, arg)
+		case "RCPT":
+			rc.rcpt(s, arg)
+		case "DATA":
+			if !rc.data(s) {
+				return
+			}
+		case "RSET":
+			s.reset()
+			s.reply(250, "ok")
+		case "NOOP":
+			s.reply(250, "ok")
+		case "QUIT":
+			s.reply(221, "bye")
+			return
+		default:
+			s.reply(502, "command not implemented")
+		}
+	}
+}
+
+// auth reads the credentials and checks them with Authenticate.
+func (rc *Receiver) auth(s *session, arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var username, password string
+	switch AuthMechanism(strings.ToUpper(mechanism)) {
+	case AuthPlain:
+		// base64 of "authorization identity\x00username\x00password"
+		if initial == "" {
+			s.text.PrintfLine("334 ")
+			line, err := s.text.ReadLine()
+			if err != nil {
+				return
+			}
+			initial = line
+		}
+		decoded, err := base64.StdEncoding.DecodeString(initial)
+		fields := strings.Split(string(decoded), "\x00")
+		if err != nil || len(fields) != 3 {
+			s.reply(501, "invalid PLAIN credentials")
+			return
+		}
+		username, password = fields[1], fields[2]
+	case AuthLogin:
+		// "Username:" and "Password:" base64 encoded, the username can come with the command
+		answers := []string{}
+		if initial != "" {
+			answers = append(answers, initial)
+		}
+		for _, challenge := range []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"}[len(answers):] {
+			s.text.PrintfLine("334 %s", challenge)
+			line, err := s.text.ReadLine()
+			if err != nil {
+				return
+			}
+			answers = append(answers, line)
+		}
+		for i, answer := range answers {
+			decoded, err := base64.StdEncoding.DecodeString(answer)
+			if err != nil {
+				s.reply(501, "invalid LOGIN credentials")
+				return
+			}
+			answers[i] = string(decoded)
+		}
+		username, password = answers[0], answers[1]
+	default:
+		s.reply(504, "unrecognized authentication type")
+		return
+	}
+	if rc.Authenticate != nil && !rc.Authenticate(AuthMechanism(strings.ToUpper(mechanism)), username, password) {
+		s.reply(535, "authentication failed")
+		return
+	}
+	s.reply(235, "authentication successful")
+}
+
+func (rc *Receiver) mail(s *session, arg string) {
+	if !s.greeted {
+		s.reply(503, "say EHLO first")
+		return
+	}
+	address, ok := pathArgument(arg, "FROM:")
+	if !ok {
+		s.reply(501, "syntax: MAIL FROM:<address>")
+		return
+	}
+	s.reset()
+	s.from, s.hasFrom = address, true
+	s.reply(250, "ok")
+}
+
+func (rc *Receiver) rcpt(s *session, arg string) {
+	if !s.hasFrom {
+		s.reply(503, "need MAIL first")
+		return
+	}
+	address, ok := pathArgument(arg, "TO:")
+	if !ok || address == "" {
+		s.reply(501, "syntax: RCPT TO:<address>")
+		return
+	}
+	if _, err := mail.ParseAddress(address); err != nil {
+		s.reply(553, "invalid address")
+		return
+	}
+	s.recipients = append(s.recipients, address)
+	s.reply(250, "ok")
+}
+
+// data stores the message, it returns false when the connection is broken.
+func (rc *Receiver) data(s *session) bool {
+	if !s.hasFrom || len(s.recipients) == 0 {
+		s.reply(503, "need MAIL and RCPT first")
+		return true
+	}
+	s.reply(354, "end data with <CR><LF>.<CR><LF>")
+	dot := s.text.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(dot, rc.MaxMessageBytes+1))
+	if err != nil {
+		return false
+	}
+	if int64(len(raw)) > rc.MaxMessageBytes {
+		// read what is left of the message, the client is still sending it
+		if _, err := io.Copy(io.Discard, dot); err != nil {
+			return false
+		}
+		s.reply(552, "%v", errMessageTooBig)
+		s.reset()
+		return true
+	}
+	msg, err := rc.inbox.Add(s.from, s.recipients, raw)
+	s.reset()
+	if err != nil {
+		s.reply(554, "invalid message: %v", err)
+		return true
+	}
+	s.reply(250, "ok: queued as %d", msg.ID)
+	return true
+}
+
+// pathArgument reads "FROM:<address> PARAMS", parameters like SIZE= and BODY= are ignored.
+func pathArgument(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") {
+		return "", false
+	}
+	return path[1 : len(path)-1], true
+}
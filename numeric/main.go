@@ -0,0 +1,149 @@
+package numeric
+
+import (
+	"errors"
+	"math"
+)
+
+// --- Numeric constraints ---
+/*
+
+	NumbersWith64Bits in the generics package only allows ~float64 | ~int,
+	and divideNumbers panics when an integer is divided by zero.
+
+	This package has constraints for EVERY integer and float kind, plus
+	"safe" arithmetic that returns an error instead of panicking or
+	silently wrapping around:
+
+	- Divide returns ErrDivideByZero when the divisor is zero.
+	- Add, Sub and Mul return ErrOverflow when the result does not fit in T.
+
+	stats.go builds streaming statistics (mean, variance, min/max, median,
+	percentiles) on top of these constraints.
+*/
+
+var (
+	ErrDivideByZero = errors.New("division by zero")
+	ErrOverflow     = errors.New("numeric overflow")
+)
+
+type Signed interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+type Unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+type Integer interface {
+	Signed | Unsigned
+}
+
+type Float interface {
+	~float32 | ~float64
+}
+
+type Number interface {
+	Integer | Float
+}
+
+// Divide divides x by y, it never panics.
+func Divide[T Number](x, y T) (T, error) {
+	var zero T
+	if y == 0 {
+		return zero, ErrDivideByZero
+	}
+	if isFloat[T]() {
+		return checkFloat(x/y, x, y)
+	}
+	// the only integer division that overflows: the smallest signed value divided by -1
+	if isSigned[T]() && y == zero-1 && isMinSigned(x) {
+		return zero, ErrOverflow
+	}
+	return x / y, nil
+}
+
+// Add returns x + y or ErrOverflow when the sum does not fit in T.
+func Add[T Number](x, y T) (T, error) {
+	var zero T
+	sum := x + y
+	switch {
+	case isFloat[T]():
+		return checkFloat(sum, x, y)
+	case isSigned[T]():
+		if (x > 0 && y > 0 && sum < 0) || (x < 0 && y < 0 && sum >= 0) {
+			return zero, ErrOverflow
+		}
+	default:
+		if sum < x {
+			return zero, ErrOverflow
+		}
+	}
+	return sum, nil
+}
+
+// Sub returns x - y or ErrOverflow when the difference does not fit in T.
+func Sub[T Number](x, y T) (T, error) {
+	var zero T
+	diff := x - y
+	switch {
+	case isFloat[T]():
+		return checkFloat(diff, x, y)
+	case isSigned[T]():
+		if (x >= 0 && y < 0 && diff < 0) || (x < 0 && y > 0 && diff >= 0) {
+			return zero, ErrOverflow
+		}
+	default:
+		if y > x {
+			return zero, ErrOverflow
+		}
+	}
+	return diff, nil
+}
+
+// Mul returns x * y or ErrOverflow when the product does not fit in T.
+func Mul[T Number](x, y T) (T, error) {
+	var zero T
+	product := x * y
+	if isFloat[T]() {
+		return checkFloat(product, x, y)
+	}
+	if x == 0 || y == 0 {
+		return zero, nil
+	}
+	if product/y != x {
+		return zero, ErrOverflow
+	}
+	// min * -1 wraps to min and min / -1 == min, so the check above misses it
+	if isSigned[T]() && y == zero-1 && isMinSigned(x) {
+		return zero, ErrOverflow
+	}
+	return product, nil
+}
+
+// isFloat is true for float kinds: 1/2 is only different from zero for floats.
+func isFloat[T Number]() bool {
+	var half T = 1
+	half /= 2
+	return half != 0
+}
+
+// isSigned is true for signed integers and floats: zero minus one is only negative for them.
+func isSigned[T Number]() bool {
+	var zero T
+	return zero-1 < 0
+}
+
+// isMinSigned is true for the smallest value of a signed integer, the only one that is its own negation.
+func isMinSigned[T Number](x T) bool {
+	return x < 0 && -x == x
+}
+
+// checkFloat reports an overflow when finite operands produced an infinite result.
+func checkFloat[T Number](result, x, y T) (T, error) {
+	if math.IsInf(float64(result), 0) && !math.IsInf(float64(x), 0) && !math.IsInf(float64(y), 0) {
+		var zero T
+		return zero, ErrOverflow
+	}
+	return result, nil
+}
@@ -0,0 +1,146 @@
+package numeric
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+// --- Streaming statistics ---
+/*
+
+	We want statistics over send costs and latencies, but we don't want to
+	keep every single value in memory. A Stream sees each value once:
+
+	- count, mean and variance use Welford's algorithm, which is stable
+	even with millions of values.
+	- min and max are kept as they come.
+	- median and percentiles are estimated with a t-digest (see tdigest.go),
+	which keeps a small number of clusters instead of all the values.
+
+	A Stream is safe for concurrent use.
+*/
+
+var (
+	ErrEmptyStream       = errors.New("stream has no values")
+	ErrNaN               = errors.New("value is NaN")
+	ErrInvalidPercentile = errors.New("percentile must be between 0 and 100")
+)
+
+// DefaultCompression is the t-digest compression used by NewStream,
+// higher values are more accurate and use more memory.
+const DefaultCompression = 100
+
+type Stream[T Number] struct {
+	mu     *sync.Mutex
+	count  int
+	mean   float64
+	m2     float64 // sum of squared differences from the mean
+	min    T
+	max    T
+	digest *TDigest
+}
+
+func NewStream[T Number]() *Stream[T] {
+	return &Stream[T]{
+		mu:     &sync.Mutex{},
+		digest: NewTDigest(DefaultCompression),
+	}
+}
+
+// Add adds the values to the stream. A NaN would make min, max and mean NaN
+// forever, so when one of the values is NaN none of them is added.
+func (s *Stream[T]) Add(values ...T) error {
+	for _, v := range values {
+		if math.IsNaN(float64(v)) {
+			return ErrNaN
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range values {
+		if s.count == 0 || v < s.min {
+			s.min = v
+		}
+		if s.count == 0 || v > s.max {
+			s.max = v
+		}
+		s.count++
+		x := float64(v)
+		delta := x - s.mean
+		s.mean += delta / float64(s.count)
+		s.m2 += delta * (x - s.mean)
+		s.digest.Add(x)
+	}
+	return nil
+}
+
+func (s *Stream[T]) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func (s *Stream[T]) Mean() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0, ErrEmptyStream
+	}
+	return s.mean, nil
+}
+
+// Variance returns the sample variance, it needs at least two values.
+func (s *Stream[T]) Variance() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count < 2 {
+		return 0, ErrEmptyStream
+	}
+	return s.m2 / float64(s.count-1), nil
+}
+
+func (s *Stream[T]) StdDev() (float64, error) {
+	variance, err := s.Variance()
+	if err != nil {
+		return 0, err
+	}
+	return math.Sqrt(variance), nil
+}
+
+func (s *Stream[T]) Min() (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		var zero T
+		return zero, ErrEmptyStream
+	}
+	return s.min, nil
+}
+
+func (s *Stream[T]) Max() (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		var zero T
+		return zero, ErrEmptyStream
+	}
+	return s.max, nil
+}
+
+func (s *Stream[T]) Median() (float64, error) {
+	return s.Percentile(50)
+}
+
+// Percentile estimates the p-th percentile (0 <= p <= 100).
+func (s *Stream[T]) Percentile(p float64) (float64, error) {
+	if math.IsNaN(p) || p < 0 || p > 100 {
+		return 0, ErrInvalidPercentile
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0, ErrEmptyStream
+	}
+	return s.digest.Quantile(p / 100)
+}
@@ -0,0 +1,145 @@
+package numeric
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// --- t-digest ---
+/*
+
+	A t-digest summarizes a stream of values with a few "centroids"
+	(a mean and the number of values it represents).
+
+	Centroids near the median can be big, but centroids near the tails
+	(percentile 1, 99, ...) are kept small, which makes the extreme
+	percentiles (the ones we care about for latencies) very accurate.
+
+	This is the "merging" variant: new values go to a buffer and, when the
+	buffer is full, buffer and centroids are sorted and merged together.
+*/
+
+var ErrInvalidQuantile = errors.New("quantile must be between 0 and 1")
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	count       float64
+	min         float64
+	max         float64
+}
+
+func NewTDigest(compression float64) *TDigest {
+	if compression < 10 {
+		compression = 10
+	}
+	return &TDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (td *TDigest) Add(x float64) {
+	if math.IsNaN(x) {
+		return
+	}
+	td.buffer = append(td.buffer, centroid{mean: x, weight: 1})
+	td.count++
+	td.min = math.Min(td.min, x)
+	td.max = math.Max(td.max, x)
+	if len(td.buffer) >= int(td.compression)*5 {
+		td.merge()
+	}
+}
+
+func (td *TDigest) Count() int {
+	return int(td.count)
+}
+
+// Quantile estimates the value below which a fraction q of the values fall.
+func (td *TDigest) Quantile(q float64) (float64, error) {
+	if q < 0 || q > 1 {
+		return 0, ErrInvalidQuantile
+	}
+	td.merge()
+	if len(td.centroids) == 0 {
+		return 0, ErrEmptyStream
+	}
+	switch {
+	case q == 0:
+		return td.min, nil
+	case q == 1:
+		return td.max, nil
+	case len(td.centroids) == 1:
+		return td.centroids[0].mean, nil
+	}
+
+	target := q * td.count
+	first, last := td.centroids[0], td.centroids[len(td.centroids)-1]
+	// before the center of the first centroid: between the minimum and its mean
+	if target < first.weight/2 {
+		return interpolate(td.min, first.mean, target/(first.weight/2)), nil
+	}
+	// after the center of the last centroid: between its mean and the maximum
+	if target > td.count-last.weight/2 {
+		rest := target - (td.count - last.weight/2)
+		return interpolate(last.mean, td.max, rest/(last.weight/2)), nil
+	}
+
+	cumulative := first.weight / 2 // center of the first centroid
+	for i := 0; i < len(td.centroids)-1; i++ {
+		current, next := td.centroids[i], td.centroids[i+1]
+		gap := (current.weight + next.weight) / 2 // distance between both centers
+		if target <= cumulative+gap {
+			return interpolate(current.mean, next.mean, (target-cumulative)/gap), nil
+		}
+		cumulative += gap
+	}
+	return last.mean, nil
+}
+
+// merge folds the buffer into the centroids.
+func (td *TDigest) merge() {
+	if len(td.buffer) == 0 {
+		return
+	}
+	all := append(td.centroids, td.buffer...)
+	td.buffer = td.buffer[:0]
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].mean < all[j].mean
+	})
+
+	merged := make([]centroid, 0, len(all))
+	current := all[0]
+	seen := 0.0 // weight of the centroids already closed
+	for _, c := range all[1:] {
+		q := (seen + (current.weight+c.weight)/2) / td.count
+		if current.weight+c.weight <= td.maxWeight(q) {
+			// merge c into current keeping the weighted mean
+			current.weight += c.weight
+			current.mean += (c.mean - current.mean) * c.weight / current.weight
+			continue
+		}
+		merged = append(merged, current)
+		seen += current.weight
+		current = c
+	}
+	td.centroids = append(merged, current)
+}
+
+// maxWeight is the biggest centroid allowed at quantile q: small at the tails, big at the median.
+func (td *TDigest) maxWeight(q float64) float64 {
+	return math.Max(1, 4*td.count*q*(1-q)/td.compression)
+}
+
+func interpolate(from, to, fraction float64) float64 {
+	return from + (to-from)*math.Max(0, math.Min(1, fraction))
+}
@@ -0,0 +1,248 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Payment Gateway ---
+/*
+
+	At Mailio chargeForLineItem only checks an in-memory balance,
+	no real money moves. The PaymentGateway interface describes what we need
+	from a payment processor:
+
+	- Authorize: holds an amount on the customer's payment method.
+	- Capture: takes (part of) an authorized amount.
+	- Refund: gives back (part of) a captured amount.
+	- Void: cancels an authorization that was not captured.
+
+	Every request carries an IdempotencyKey. Networks fail, so a request
+	that timed out is retried with the SAME key, and the processor answers
+	with the result of the first request instead of charging twice.
+
+	HTTPGateway talks to a processor over HTTP and MockProcessor (mock.go)
+	is a local processor we can use while developing.
+*/
+
+var (
+	ErrDeclined                = errors.New("payment declined")
+	ErrTimeout                 = errors.New("payment processor timed out")
+	ErrUnavailable             = errors.New("payment processor unavailable")
+	ErrMissingIdempotencyKey   = errors.New("missing idempotency key")
+	ErrIdempotencyKeyReused    = errors.New("idempotency key reused with a different request")
+	ErrTransactionNotFound     = errors.New("transaction not found")
+	ErrInvalidAmount           = errors.New("invalid amount")
+	ErrInvalidTransactionState = errors.New("invalid transaction state")
+)
+
+type PaymentGateway interface {
+	Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error)
+	Capture(ctx context.Context, req CaptureRequest) (Transaction, error)
+	Refund(ctx context.Context, req RefundRequest) (Transaction, error)
+	Void(ctx context.Context, req VoidRequest) (Transaction, error)
+}
+
+type AuthorizeRequest struct {
+	IdempotencyKey string  `json:"-"`
+	CustomerEmail  string  `json:"customer_email"`
+	PaymentMethod  string  `json:"payment_method"`
+	Amount         float64 `json:"amount"`
+	Description    string  `json:"description"`
+}
+
+type CaptureRequest struct {
+	IdempotencyKey  string  `json:"-"`
+	AuthorizationID string  `json:"authorization_id"`
+	Amount          float64 `json:"amount"`
+}
+
+type RefundRequest struct {
+	IdempotencyKey string  `json:"-"`
+	CaptureID      string  `json:"capture_id"`
+	Amount         float64 `json:"amount"`
+}
+
+type VoidRequest struct {
+	IdempotencyKey  string `json:"-"`
+	AuthorizationID string `json:"authorization_id"`
+}
+
+// Transaction kinds.
+const (
+	KindAuthorization = "authorization"
+	KindCapture       = "capture"
+	KindRefund        = "refund"
+	KindVoid          = "void"
+)
+
+type Transaction struct {
+	ID              string    `json:"id"`
+	Kind            string    `json:"kind"`
+	AuthorizationID string    `json:"authorization_id,omitempty"`
+	CaptureID       string    `json:"capture_id,omitempty"`
+	Amount          float64   `json:"amount"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// --- HTTP Gateway ---
+
+// errorResponse is the body of every failed response of the processor.
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// error codes sent by the processor and the errors they map to.
+var errorCodes = map[string]error{
+	"declined":                  ErrDeclined,
+	"missing_idempotency_key":   ErrMissingIdempotencyKey,
+	"idempotency_key_reused":    ErrIdempotencyKeyReused,
+	"transaction_not_found":     ErrTransactionNotFound,
+	"invalid_amount":            ErrInvalidAmount,
+	"invalid_transaction_state": ErrInvalidTransactionState,
+}
+
+// processorError keeps the message of the processor and unwraps to the known error of its code,
+// so errors.Is(err, ErrDeclined) works on the client side.
+type processorError struct {
+	code    string
+	message string
+	known   error
+}
+
+func (pe processorError) Error() string {
+	return pe.message
+}
+
+func (pe processorError) Unwrap() error {
+	return pe.known
+}
+
+// defaultRetryBackoff is the wait before the first retry, it doubles on every
+// attempt up to maxRetryBackoff.
+const (
+	defaultRetryBackoff = 200 * time.Millisecond
+	maxRetryBackoff     = 5 * time.Second
+)
+
+// HTTPGateway is a PaymentGateway that talks to a processor over HTTP.
+// Requests that time out are retried with the same idempotency key,
+// waiting Backoff before the first retry and twice as long before every next one.
+type HTTPGateway struct {
+	BaseURL    string
+	Client     *http.Client
+	MaxRetries int
+	Backoff    time.Duration // defaultRetryBackoff when zero
+}
+
+func NewHTTPGateway(baseURL string, timeout time.Duration, maxRetries int) HTTPGateway {
+	return HTTPGateway{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Client:     &http.Client{Timeout: timeout},
+		MaxRetries: maxRetries,
+		Backoff:    defaultRetryBackoff,
+	}
+}
+
+func (g HTTPGateway) Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error) {
+	return g.do(ctx, "/authorize", req.IdempotencyKey, req)
+}
+
+func (g HTTPGateway) Capture(ctx context.Context, req CaptureRequest) (Transaction, error) {
+	return g.do(ctx, "/capture", req.IdempotencyKey, req)
+}
+
+func (g HTTPGateway) Refund(ctx context.Context, req RefundRequest) (Transaction, error) {
+	return g.do(ctx, "/refund", req.IdempotencyKey, req)
+}
+
+func (g HTTPGateway) Void(ctx context.Context, req VoidRequest) (Transaction, error) {
+	return g.do(ctx, "/void", req.IdempotencyKey, req)
+}
+
+func (g HTTPGateway) do(ctx context.Context, path, idempotencyKey string, payload any) (Transaction, error) {
+	if idempotencyKey == "" {
+		return Transaction{}, ErrMissingIdempotencyKey
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Transaction{}, err
+	}
+	for attempt := 0; ; attempt++ {
+		tx, err := g.send(ctx, path, idempotencyKey, body)
+		retryable := errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable)
+		if !retryable || attempt >= g.MaxRetries || ctx.Err() != nil {
+			return tx, err
+		}
+		// a processor that is down or overloaded needs time, don't hammer it
+		select {
+		case <-time.After(g.retryBackoff(attempt)):
+		case <-ctx.Done():
+			return Transaction{}, ctx.Err()
+		}
+	}
+}
+
+// retryBackoff is the wait before retrying after the failed attempt (0 is the first one).
+func (g HTTPGateway) retryBackoff(attempt int) time.Duration {
+	backoff := g.Backoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	for i := 0; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
+func (g HTTPGateway) send(ctx context.Context, path, idempotencyKey string, body []byte) (Transaction, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return Transaction{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return Transaction{}, fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return Transaction{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return Transaction{}, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			return Transaction{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return Transaction{}, processorError{
+			code:    errResp.Code,
+			message: errResp.Message,
+			known:   errorCodes[errResp.Code],
+		}
+	}
+
+	var tx Transaction
+	if err := json.NewDecoder(resp.Body).Decode(&tx); err != nil {
+		return Transaction{}, err
+	}
+	return tx, nil
+}
@@ -0,0 +1,316 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- Mock Processor ---
+/*
+
+	MockProcessor is a local payment processor that speaks the same HTTP
+	API as HTTPGateway. It keeps everything in memory and can simulate
+	the bad days of a real processor:
+
+	- DeclineMethod: every authorization with that payment method is declined.
+	- DelayNext: the next n responses are delayed, which makes the client
+	time out AFTER the processor already did the work. This is exactly
+	the case where idempotency keys save us from charging twice.
+
+	Requests with an idempotency key that was already used are not
+	processed again, the stored response is replayed. Reusing a key with a
+	different request body is rejected.
+*/
+
+type storedResponse struct {
+	body   []byte // request body, to detect a reused key
+	status int
+	resp   []byte
+}
+
+type authorizationState struct {
+	tx       Transaction
+	captured float64
+	voided   bool
+}
+
+type captureState struct {
+	tx       Transaction
+	refunded float64
+}
+
+// MockStats counts what the processor did.
+type MockStats struct {
+	Processed  int // requests that were processed
+	Replayed   int // duplicated requests answered from the idempotency store
+	Conflicts  int // keys reused with a different request
+	Authorized float64
+	Captured   float64
+	Refunded   float64
+}
+
+type MockProcessor struct {
+	mu             *sync.Mutex
+	responses      map[string]storedResponse
+	authorizations map[string]*authorizationState
+	captures       map[string]*captureState
+	declined       map[string]bool
+	delays         []time.Duration
+	nextID         int
+	stats          MockStats
+	now            func() time.Time
+}
+
+func NewMockProcessor() *MockProcessor {
+	return &MockProcessor{
+		mu:             &sync.Mutex{},
+		responses:      map[string]storedResponse{},
+		authorizations: map[string]*authorizationState{},
+		captures:       map[string]*captureState{},
+		declined:       map[string]bool{},
+		now:            time.Now,
+	}
+}
+
+// DeclineMethod makes every authorization with the payment method fail.
+func (mp *MockProcessor) DeclineMethod(paymentMethod string) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.declined[paymentMethod] = true
+}
+
+// DelayNext delays the next n responses, the requests are still processed.
+func (mp *MockProcessor) DelayNext(n int, delay time.Duration) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	for i := 0; i < n; i++ {
+		mp.delays = append(mp.delays, delay)
+	}
+}
+
+func (mp *MockProcessor) Stats() MockStats {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.stats
+}
+
+// Start serves the processor on addr (for example "127.0.0.1:0") and returns its base URL.
+func (mp *MockProcessor) Start(addr string) (baseURL string, shutdown func(context.Context) error, err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	server := &http.Server{Handler: mp}
+	go server.Serve(listener)
+	return "http://" + listener.Addr().String(), server.Shutdown, nil
+}
+
+func (mp *MockProcessor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Code: "bad_request", Message: err.Error()})
+		return
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Code: "missing_idempotency_key", Message: "Idempotency-Key header is required"})
+		return
+	}
+
+	status, resp, delay := mp.process(r.URL.Path, key, body)
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// process runs the request once per idempotency key and stores its response.
+func (mp *MockProcessor) process(path, key string, body []byte) (status int, resp []byte, delay time.Duration) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if len(mp.delays) > 0 {
+		delay = mp.delays[0]
+		mp.delays = mp.delays[1:]
+	}
+
+	storeKey := path + " " + key
+	if stored, ok := mp.responses[storeKey]; ok {
+		if !bytes.Equal(stored.body, body) {
+			mp.stats.Conflicts++
+			status, resp = marshalError(http.StatusConflict, "idempotency_key_reused", ErrIdempotencyKeyReused)
+			return status, resp, delay
+		}
+		mp.stats.Replayed++
+		return stored.status, stored.resp, delay
+	}
+
+	tx, err := mp.handle(path, body)
+	if err != nil {
+		status, resp = marshalError(statusFor(err), codeFor(err), err)
+	} else {
+		status = http.StatusOK
+		resp, _ = json.Marshal(tx)
+	}
+	mp.stats.Processed++
+	mp.responses[storeKey] = storedResponse{body: body, status: status, resp: resp}
+	return status, resp, delay
+}
+
+// handle must be called with the mutex locked.
+func (mp *MockProcessor) handle(path string, body []byte) (Transaction, error) {
+	switch path {
+	case "/authorize":
+		var req AuthorizeRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return Transaction{}, err
+		}
+		return mp.authorize(req)
+	case "/capture":
+		var req CaptureRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return Transaction{}, err
+		}
+		return mp.capture(req)
+	case "/refund":
+		var req RefundRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return Transaction{}, err
+		}
+		return mp.refund(req)
+	case "/void":
+		var req VoidRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return Transaction{}, err
+		}
+		return mp.void(req)
+	default:
+		return Transaction{}, fmt.Errorf("unknown operation %s", path)
+	}
+}
+
+func (mp *MockProcessor) authorize(req AuthorizeRequest) (Transaction, error) {
+	if req.Amount <= 0 {
+		return Transaction{}, ErrInvalidAmount
+	}
+	if mp.declined[req.PaymentMethod] {
+		return Transaction{}, fmt.Errorf("%w: payment method %s", ErrDeclined, req.PaymentMethod)
+	}
+	tx := mp.newTransaction(KindAuthorization, req.Amount)
+	tx.AuthorizationID = tx.ID
+	mp.authorizations[tx.ID] = &authorizationState{tx: tx}
+	mp.stats.Authorized += req.Amount
+	return tx, nil
+}
+
+func (mp *MockProcessor) capture(req CaptureRequest) (Transaction, error) {
+	auth, ok := mp.authorizations[req.AuthorizationID]
+	if !ok {
+		return Transaction{}, ErrTransactionNotFound
+	}
+	if auth.voided {
+		return Transaction{}, ErrInvalidTransactionState
+	}
+	if req.Amount <= 0 || auth.captured+req.Amount > auth.tx.Amount {
+		return Transaction{}, ErrInvalidAmount
+	}
+	tx := mp.newTransaction(KindCapture, req.Amount)
+	tx.AuthorizationID = auth.tx.ID
+	tx.CaptureID = tx.ID
+	auth.captured += req.Amount
+	mp.captures[tx.ID] = &captureState{tx: tx}
+	mp.stats.Captured += req.Amount
+	return tx, nil
+}
+
+func (mp *MockProcessor) refund(req RefundRequest) (Transaction, error) {
+	capture, ok := mp.captures[req.CaptureID]
+	if !ok {
+		return Transaction{}, ErrTransactionNotFound
+	}
+	if req.Amount <= 0 || capture.refunded+req.Amount > capture.tx.Amount {
+		return Transaction{}, ErrInvalidAmount
+	}
+	tx := mp.newTransaction(KindRefund, req.Amount)
+	tx.AuthorizationID = capture.tx.AuthorizationID
+	tx.CaptureID = capture.tx.ID
+	capture.refunded += req.Amount
+	mp.stats.Refunded += req.Amount
+	return tx, nil
+}
+
+func (mp *MockProcessor) void(req VoidRequest) (Transaction, error) {
+	auth, ok := mp.authorizations[req.AuthorizationID]
+	if !ok {
+		return Transaction{}, ErrTransactionNotFound
+	}
+	if auth.voided || auth.captured > 0 {
+		return Transaction{}, ErrInvalidTransactionState
+	}
+	auth.voided = true
+	tx := mp.newTransaction(KindVoid, auth.tx.Amount)
+	tx.AuthorizationID = auth.tx.ID
+	mp.stats.Authorized -= auth.tx.Amount
+	return tx, nil
+}
+
+func (mp *MockProcessor) newTransaction(kind string, amount float64) Transaction {
+	mp.nextID++
+	return Transaction{
+		ID:        fmt.Sprintf("%s_%d", kind, mp.nextID),
+		Kind:      kind,
+		Amount:    amount,
+		CreatedAt: mp.now().UTC(),
+	}
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidTransactionState):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func codeFor(err error) string {
+	for code, known := range errorCodes {
+		if errors.Is(err, known) {
+			return code
+		}
+	}
+	return "bad_request"
+}
+
+func marshalError(status int, code string, err error) (int, []byte) {
+	resp, _ := json.Marshal(errorResponse{Code: code, Message: err.Error()})
+	return status, resp
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}